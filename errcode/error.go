@@ -25,6 +25,9 @@ type Error struct {
 	error        // err is the error message, human friendly.
 }
 
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error { return e.error }
+
 // Common general error codes
 const (
 	NotFound     = "not-found"
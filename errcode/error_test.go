@@ -17,6 +17,8 @@ package errcode
 
 import (
 	"testing"
+
+	"errors"
 )
 
 func TestCommonError(t *testing.T) {
@@ -35,3 +37,11 @@ func TestCommonError(t *testing.T) {
 		}
 	}
 }
+
+func TestUnwrap(t *testing.T) {
+	base := errors.New("base")
+	err := Add(NotFound, base)
+	if !errors.Is(err, base) {
+		t.Errorf("%q does not unwrap to %q", err, base)
+	}
+}
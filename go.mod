@@ -3,6 +3,7 @@ module shanhu.io/misc
 go 1.16
 
 require (
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/microcosm-cc/bluemonday v1.0.15
 	github.com/russross/blackfriday v1.6.0
 	golang.org/x/crypto v0.0.0-20210711020723-a769d52b0f97
@@ -0,0 +1,106 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httputil
+
+import (
+	"context"
+	"net/http"
+)
+
+// Authenticator adds credentials to outgoing requests.
+type Authenticator interface {
+	// Authenticate adds credentials to the request. The request body, if
+	// any, must not be consumed.
+	Authenticate(req *http.Request) error
+}
+
+// Refresher is an optional interface for authenticators and token sources
+// whose credentials can be refreshed. When a request is rejected with
+// HTTP 401, a client refreshes the credentials and retries the request
+// once.
+type Refresher interface {
+	Refresh(ctx context.Context) error
+}
+
+// BasicAuth authenticates requests with HTTP basic authentication.
+type BasicAuth struct {
+	User     string
+	Password string
+}
+
+// Authenticate sets the basic authentication header.
+func (a *BasicAuth) Authenticate(req *http.Request) error {
+	req.SetBasicAuth(a.User, a.Password)
+	return nil
+}
+
+// DefaultAPIKeyHeader is the default header that carries an API key.
+const DefaultAPIKeyHeader = "X-Api-Key"
+
+// APIKeyAuth authenticates requests with a static API key in a header.
+type APIKeyAuth struct {
+	// Header is the header that carries the key. DefaultAPIKeyHeader is
+	// used when it is empty.
+	Header string
+
+	Key string
+}
+
+// Authenticate sets the API key header.
+func (a *APIKeyAuth) Authenticate(req *http.Request) error {
+	h := a.Header
+	if h == "" {
+		h = DefaultAPIKeyHeader
+	}
+	req.Header.Set(h, a.Key)
+	return nil
+}
+
+func (c *Client) refresher() Refresher {
+	if c.Auth != nil {
+		r, _ := c.Auth.(Refresher)
+		return r
+	}
+	if c.TokenSource != nil {
+		r, _ := c.TokenSource.(Refresher)
+		return r
+	}
+	return nil
+}
+
+// reauth refreshes the credentials and returns a new request to replace a
+// request that is rejected with HTTP 401. It returns nil when the request
+// cannot be retried.
+func (c *Client) reauth(req *http.Request) (*http.Request, error) {
+	r := c.refresher()
+	if r == nil || !isReplayable(req) {
+		return nil, nil
+	}
+
+	ctx := req.Context()
+	if err := r.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	retry := req.Clone(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retry.Body = body
+	}
+	return retry, nil
+}
@@ -0,0 +1,280 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httputil
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"shanhu.io/misc/errcode"
+	"shanhu.io/misc/signer"
+)
+
+// HMACAuthScheme is the authorization scheme of HMAC signed requests.
+const HMACAuthScheme = "HMAC"
+
+// unsignedBody is the body hash of a request whose body cannot be read
+// without consuming it.
+const unsignedBody = "unsigned"
+
+func bodyHash(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return hex.EncodeToString(sha256.New().Sum(nil)), nil
+	}
+	if req.GetBody == nil {
+		return unsignedBody, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func requestURI(req *http.Request) string {
+	if req.RequestURI != "" {
+		return req.RequestURI
+	}
+	return req.URL.RequestURI()
+}
+
+func requestHost(req *http.Request) string {
+	if req.Host != "" {
+		return req.Host
+	}
+	return req.URL.Host
+}
+
+func hmacCanonical(req *http.Request, t time.Time, hash string) []byte {
+	buf := new(bytes.Buffer)
+	for _, s := range []string{
+		req.Method, requestHost(req), requestURI(req),
+		strconv.FormatInt(t.Unix(), 10), hash,
+	} {
+		buf.WriteString(s)
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
+
+// HMACAuth authenticates requests by signing them with an HMAC signer. The
+// signature covers the method, the host, the request URI, the current time
+// and the sha256 hash of the body. Bodies that cannot be replayed, such as
+// streamed uploads, are not covered.
+type HMACAuth struct {
+	Signer *signer.Signer
+
+	// TimeFunc is an optional function for reading the current timestamp.
+	// When it is nil, time.Now() is used.
+	TimeFunc func() time.Time
+}
+
+// NewHMACAuth creates an authenticator that signs requests with s.
+func NewHMACAuth(s *signer.Signer) *HMACAuth {
+	return &HMACAuth{Signer: s}
+}
+
+func timeNow(f func() time.Time) time.Time {
+	if f == nil {
+		return time.Now()
+	}
+	return f()
+}
+
+// Authenticate signs the request and sets the authorization header.
+func (a *HMACAuth) Authenticate(req *http.Request) error {
+	hash, err := bodyHash(req)
+	if err != nil {
+		return err
+	}
+	dat := hmacCanonical(req, timeNow(a.TimeFunc), hash)
+	tok := a.Signer.SignBase64(dat)
+	req.Header.Set("Authorization", HMACAuthScheme+" "+tok)
+	return nil
+}
+
+// Default values of HMACVerifier.
+const (
+	DefaultHMACWindow      = 5 * time.Minute
+	DefaultHMACMaxBodySize = 10 << 20
+)
+
+// HMACVerifier checks requests that are signed by HMACAuth.
+type HMACVerifier struct {
+	Signer *signer.Signer
+
+	// Window is the maximum difference between the signing time and the
+	// current time. DefaultHMACWindow is used when it is 0.
+	Window time.Duration
+
+	// MaxBodySize is the size limit of a signed request body, which is
+	// read into memory to check the hash. DefaultHMACMaxBodySize is used
+	// when it is 0.
+	MaxBodySize int64
+
+	// UnsignedBody accepts requests whose body is not covered by the
+	// signature.
+	UnsignedBody bool
+
+	// TimeFunc is an optional function for reading the current timestamp.
+	// When it is nil, time.Now() is used.
+	TimeFunc func() time.Time
+}
+
+func (v *HMACVerifier) window() time.Duration {
+	if v.Window == 0 {
+		return DefaultHMACWindow
+	}
+	return v.Window
+}
+
+func (v *HMACVerifier) maxBodySize() int64 {
+	if v.MaxBodySize == 0 {
+		return DefaultHMACMaxBodySize
+	}
+	return v.MaxBodySize
+}
+
+// Verify checks the signature of the request. To check the body hash, it
+// reads the body into memory and replaces the body with the read bytes.
+func (v *HMACVerifier) Verify(req *http.Request) error {
+	auth := req.Header.Get("Authorization")
+	prefix := HMACAuthScheme + " "
+	if !strings.HasPrefix(auth, prefix) {
+		return errcode.Unauthorizedf("request not signed")
+	}
+	ok, dat := v.Signer.CheckBase64(strings.TrimPrefix(auth, prefix))
+	if !ok {
+		return errcode.Unauthorizedf("invalid request signature")
+	}
+	fields := strings.Split(string(dat), "\n")
+	if len(fields) != 6 {
+		return errcode.Unauthorizedf("invalid signed data")
+	}
+	if fields[0] != req.Method || fields[1] != requestHost(req) ||
+		fields[2] != requestURI(req) {
+		return errcode.Unauthorizedf("signature is for another request")
+	}
+
+	sec, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return errcode.Unauthorizedf("invalid signing time")
+	}
+	d := timeNow(v.TimeFunc).Sub(time.Unix(sec, 0))
+	if w := v.window(); d > w || d < -w {
+		return errcode.Unauthorizedf("signature expired")
+	}
+
+	hash := fields[4]
+	if hash == unsignedBody {
+		if !v.UnsignedBody {
+			return errcode.Unauthorizedf("request body not signed")
+		}
+		return nil
+	}
+	var bs []byte
+	if req.Body != nil {
+		max := v.maxBodySize()
+		bs, err = ioutil.ReadAll(io.LimitReader(req.Body, max+1))
+		req.Body.Close()
+		if err != nil {
+			return err
+		}
+		if int64(len(bs)) > max {
+			return errcode.InvalidArgf("request body too large")
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(bs))
+	}
+	sum := sha256.Sum256(bs)
+	if hex.EncodeToString(sum[:]) != hash {
+		return errcode.Unauthorizedf("request body tampered")
+	}
+	return nil
+}
+
+// SignedTimeHeader is the header that carries a signed time block.
+const SignedTimeHeader = "X-Signed-Time"
+
+// SignedTimeAuth authenticates requests with the current time signed by a
+// private key, which can be checked with signer.RSATimeSigner or
+// signer.KeyTimeSigner.
+type SignedTimeAuth struct {
+	Key crypto.Signer
+
+	// Nonce adds a random nonce to each signed time, for checkers that
+	// reject replays.
+	Nonce bool
+}
+
+// Authenticate signs the current time and sets the signed time header.
+func (a *SignedTimeAuth) Authenticate(req *http.Request) error {
+	sign := signer.SignTimeWithKey
+	if a.Nonce {
+		sign = signer.SignTimeNonceWithKey
+	}
+	b, err := sign(a.Key)
+	if err != nil {
+		return err
+	}
+	bs, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	v := base64.RawURLEncoding.EncodeToString(bs)
+	req.Header.Set(SignedTimeHeader, v)
+	return nil
+}
+
+// TimeChecker checks signed time blocks. It is implemented by
+// *signer.RSATimeSigner and *signer.KeyTimeSigner.
+type TimeChecker interface {
+	Check(b *signer.SignedBlock) error
+}
+
+// CheckSignedTime checks the signed time header of the request.
+func CheckSignedTime(req *http.Request, c TimeChecker) error {
+	v := req.Header.Get(SignedTimeHeader)
+	if v == "" {
+		return errcode.Unauthorizedf("signed time missing")
+	}
+	bs, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return errcode.Unauthorizedf("invalid signed time encoding")
+	}
+	b := new(signer.SignedBlock)
+	if err := json.Unmarshal(bs, b); err != nil {
+		return errcode.Unauthorizedf("invalid signed time: %s", err)
+	}
+	if err := c.Check(b); err != nil {
+		return errcode.Add(errcode.Unauthorized, err)
+	}
+	return nil
+}
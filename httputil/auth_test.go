@@ -0,0 +1,288 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httputil
+
+import (
+	"testing"
+
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"shanhu.io/misc/errcode"
+	"shanhu.io/misc/signer"
+)
+
+// authChecker is a handler that replies "ok" when the request passes the
+// check, and HTTP 401 otherwise.
+type authChecker func(req *http.Request) error
+
+func (f authChecker) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if err := f(req); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+func TestBasicAndAPIKeyAuth(t *testing.T) {
+	c := newTestClient(t, authChecker(func(req *http.Request) error {
+		user, pwd, ok := req.BasicAuth()
+		if !ok || user != "alice" || pwd != "secret" {
+			return errcode.Unauthorizedf("wrong basic auth")
+		}
+		if req.Header.Get("X-Api-Key") != "key" {
+			return errcode.Unauthorizedf("wrong api key")
+		}
+		return nil
+	}))
+
+	c.Auth = &BasicAuth{User: "alice", Password: "secret"}
+	c.Middleware = []Middleware{
+		SetHeaders(http.Header{"X-Api-Key": []string{"key"}}),
+	}
+	if err := c.Poke("/"); err != nil {
+		t.Error(err)
+	}
+
+	c.Auth = &APIKeyAuth{Key: "key"}
+	c.Middleware = []Middleware{RequestHook(func(req *http.Request) error {
+		req.SetBasicAuth("alice", "secret")
+		return nil
+	})}
+	if err := c.Poke("/"); err != nil {
+		t.Error(err)
+	}
+
+	c.Auth = &APIKeyAuth{Key: "wrong"}
+	if err := c.Poke("/"); !errcode.IsUnauthorized(err) {
+		t.Errorf("want unauthorized error, got %v", err)
+	}
+}
+
+func TestHMACAuth(t *testing.T) {
+	s := signer.New([]byte("secret"))
+	v := &HMACVerifier{Signer: s, Window: time.Minute}
+	var body string
+	c := newTestClient(t, authChecker(func(req *http.Request) error {
+		if err := v.Verify(req); err != nil {
+			return err
+		}
+		bs, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		body = string(bs)
+		return nil
+	}))
+	c.Auth = NewHMACAuth(s)
+
+	if err := c.JSONCall("/call?x=1", "hello", nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := `"hello"`; body != want {
+		t.Errorf("server got body %q, want %q", body, want)
+	}
+
+	// Streamed bodies are not signed.
+	err := c.Post("/post", strings.NewReader("data"), nil)
+	if !errcode.IsUnauthorized(err) {
+		t.Errorf("want unauthorized error, got %v", err)
+	}
+	v.UnsignedBody = true
+	if err := c.Post("/post", strings.NewReader("data"), nil); err != nil {
+		t.Error(err)
+	}
+
+	// Signing happens after the middlewares, so compressed bodies are
+	// signed as sent.
+	v.UnsignedBody = false
+	c.Middleware = []Middleware{GzipRequests()}
+	if err := c.JSONCall("/call", "hello", nil); err != nil {
+		t.Error(err)
+	}
+	c.Middleware = nil
+
+	c.Auth = NewHMACAuth(signer.New([]byte("another")))
+	if err := c.Poke("/"); !errcode.IsUnauthorized(err) {
+		t.Errorf("want unauthorized error, got %v", err)
+	}
+
+	c.Auth = &HMACAuth{
+		Signer:   s,
+		TimeFunc: func() time.Time { return time.Now().Add(-time.Hour) },
+	}
+	if err := c.Poke("/"); !errcode.IsUnauthorized(err) {
+		t.Errorf("want unauthorized error, got %v", err)
+	}
+}
+
+func TestHMACAuthHost(t *testing.T) {
+	s := signer.New([]byte("secret"))
+	req, err := http.NewRequest(http.MethodGet, "https://a.com/x", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewHMACAuth(s).Authenticate(req); err != nil {
+		t.Fatal(err)
+	}
+	v := &HMACVerifier{Signer: s, Window: time.Minute}
+	if err := v.Verify(req); err != nil {
+		t.Fatal(err)
+	}
+	req.Host = "b.com"
+	if err := v.Verify(req); !errcode.IsUnauthorized(err) {
+		t.Errorf("want unauthorized error for another host, got %v", err)
+	}
+}
+
+func TestHMACVerifierDefaults(t *testing.T) {
+	s := signer.New([]byte("secret"))
+	newReq := func(body string) *http.Request {
+		req, err := http.NewRequest(
+			http.MethodPost, "https://a.com/x", strings.NewReader(body),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := NewHMACAuth(s).Authenticate(req); err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	v := &HMACVerifier{Signer: s}
+	if err := v.Verify(newReq("hello")); err != nil {
+		t.Errorf("verify with default window: %s", err)
+	}
+
+	v.MaxBodySize = 4
+	err := v.Verify(newReq("hello"))
+	if err == nil || errcode.IsUnauthorized(err) {
+		t.Errorf("want body too large error, got %v", err)
+	}
+}
+
+func TestAuthRedirect(t *testing.T) {
+	var got []string
+	landing := func(w http.ResponseWriter, req *http.Request) {
+		got = append(got, req.Header.Get("Authorization"))
+	}
+	other := httptest.NewServer(http.HandlerFunc(landing))
+	defer other.Close()
+	otherURL := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+
+	c := newTestClient(t, http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			switch req.URL.Path {
+			case "/away":
+				http.Redirect(w, req, otherURL+"/landing", http.StatusFound)
+			case "/near":
+				http.Redirect(w, req, "/landing", http.StatusFound)
+			default:
+				landing(w, req)
+			}
+		},
+	))
+	c.Token = "secret-token"
+
+	for _, p := range []string{"/away", "/near"} {
+		if err := c.Poke(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"", "Bearer secret-token"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got authorization %q, want %q", got, want)
+	}
+}
+
+func TestSignedTimeAuth(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := signer.NewRSATimeSigner(&key.PublicKey, time.Minute)
+	c := newTestClient(t, authChecker(func(req *http.Request) error {
+		return CheckSignedTime(req, ts)
+	}))
+
+	c.Auth = &SignedTimeAuth{Key: key}
+	if err := c.Poke("/"); err != nil {
+		t.Error(err)
+	}
+
+	c.Auth = nil
+	if err := c.Poke("/"); !errcode.IsUnauthorized(err) {
+		t.Errorf("want unauthorized error, got %v", err)
+	}
+}
+
+type refreshingAuth struct {
+	key       string
+	fresh     string
+	refreshes int
+}
+
+func (a *refreshingAuth) Authenticate(req *http.Request) error {
+	req.Header.Set("X-Api-Key", a.key)
+	return nil
+}
+
+func (a *refreshingAuth) Refresh(ctx context.Context) error {
+	a.refreshes++
+	a.key = a.fresh
+	return nil
+}
+
+func TestAuthRefresh(t *testing.T) {
+	var bodies []string
+	c := newTestClient(t, authChecker(func(req *http.Request) error {
+		bs, _ := ioutil.ReadAll(req.Body)
+		bodies = append(bodies, string(bs))
+		if req.Header.Get("X-Api-Key") != "fresh" {
+			return errcode.Unauthorizedf("stale key")
+		}
+		return nil
+	}))
+
+	auth := &refreshingAuth{key: "stale", fresh: "fresh"}
+	c.Auth = auth
+	if err := c.PutBytes("/", []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if auth.refreshes != 1 {
+		t.Errorf("got %d refreshes, want 1", auth.refreshes)
+	}
+	if len(bodies) != 2 || bodies[1] != "data" {
+		t.Errorf("got bodies %q, want the body sent twice", bodies)
+	}
+
+	// Retries only once.
+	auth = &refreshingAuth{key: "stale", fresh: "still-stale"}
+	c.Auth = auth
+	if err := c.Poke("/"); !errcode.IsUnauthorized(err) {
+		t.Errorf("want unauthorized error, got %v", err)
+	}
+	if auth.refreshes != 1 {
+		t.Errorf("got %d refreshes, want 1", auth.refreshes)
+	}
+}
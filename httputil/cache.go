@@ -0,0 +1,285 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httputil
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"shanhu.io/misc/errcode"
+)
+
+// DefaultCacheMaxEntrySize is the default size limit of a cached response
+// body.
+const DefaultCacheMaxEntrySize = 10 << 20
+
+// CacheStats contains the statistics of a cache.
+type CacheStats struct {
+	Hits        int64 // Responses served from the cache.
+	Revalidated int64 // Responses served after a 304 Not Modified reply.
+	Misses      int64 // Responses fetched from the server.
+}
+
+// Cache is a client-side HTTP cache for GET requests. Fresh responses, as
+// given by Cache-Control max-age, are served from the store. Stale
+// responses with an ETag or a Last-Modified header are revalidated with a
+// conditional request. Responses with Cache-Control no-store are never
+// stored.
+//
+// Responses are keyed by URL only, so a cache should not be shared by
+// clients with different credentials.
+type Cache struct {
+	store CacheStore
+
+	// MaxEntrySize is the size limit of a cached response body. Larger
+	// responses are not cached. DefaultCacheMaxEntrySize is used when it
+	// is 0.
+	MaxEntrySize int64
+
+	// TimeFunc is an optional function for reading the current timestamp.
+	// When it is nil, time.Now() is used.
+	TimeFunc func() time.Time
+
+	// Logf is an optional function for logging store errors. Store errors
+	// do not fail requests; a failed read is a cache miss, and a failed
+	// write leaves the response uncached.
+	Logf func(format string, args ...interface{})
+
+	hits        int64
+	revalidated int64
+	misses      int64
+}
+
+// NewCache creates a cache that saves responses in the store.
+func NewCache(store CacheStore) *Cache {
+	return &Cache{store: store}
+}
+
+// Stats returns the hit and miss statistics of the cache.
+func (c *Cache) Stats() *CacheStats {
+	return &CacheStats{
+		Hits:        atomic.LoadInt64(&c.hits),
+		Revalidated: atomic.LoadInt64(&c.revalidated),
+		Misses:      atomic.LoadInt64(&c.misses),
+	}
+}
+
+func (c *Cache) logf(format string, args ...interface{}) {
+	if c.Logf != nil {
+		c.Logf(format, args...)
+	}
+}
+
+func (c *Cache) put(key string, e *CacheEntry) {
+	if err := c.store.Put(key, e); err != nil {
+		c.logf("cache put %q: %s", key, err)
+	}
+}
+
+func (c *Cache) maxEntrySize() int64 {
+	if c.MaxEntrySize == 0 {
+		return DefaultCacheMaxEntrySize
+	}
+	return c.MaxEntrySize
+}
+
+type cacheControl map[string]string
+
+func parseCacheControl(h http.Header) cacheControl {
+	cc := make(cacheControl)
+	for _, v := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(v, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			k, v := part, ""
+			if i := strings.Index(part, "="); i >= 0 {
+				k, v = part[:i], strings.Trim(part[i+1:], `"`)
+			}
+			cc[strings.ToLower(k)] = v
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(k string) bool {
+	_, ok := cc[k]
+	return ok
+}
+
+// maxAge returns the freshness lifetime of a response. Responses with
+// no-cache or without max-age are always revalidated.
+func (cc cacheControl) maxAge() time.Duration {
+	if cc.has("no-cache") {
+		return 0
+	}
+	sec, err := strconv.ParseInt(cc["max-age"], 10, 64)
+	if err != nil || sec <= 0 {
+		return 0
+	}
+	return time.Duration(sec) * time.Second
+}
+
+func (e *CacheEntry) validatable() bool {
+	return e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != ""
+}
+
+func (e *CacheEntry) response(req *http.Request) *http.Response {
+	status := fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	return &http.Response{
+		Status:        status,
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+func cacheable(req *http.Request) bool {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return false
+	}
+	// Leaves conditional requests made by the caller alone.
+	if req.Header.Get("If-None-Match") != "" ||
+		req.Header.Get("If-Modified-Since") != "" {
+		return false
+	}
+	return !parseCacheControl(req.Header).has("no-store")
+}
+
+// Wrap returns a round tripper that serves requests from the cache, and
+// sends the others to next. Its method value can be used as a Middleware.
+func (c *Cache) Wrap(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if !cacheable(req) {
+			return next.RoundTrip(req)
+		}
+		return c.roundTrip(next, req)
+	})
+}
+
+func (c *Cache) roundTrip(
+	next http.RoundTripper, req *http.Request,
+) (*http.Response, error) {
+	key := req.URL.String()
+	e, err := c.store.Get(key)
+	if err != nil {
+		// Treats it as a miss; the entry is overwritten when the response
+		// is saved.
+		if !errcode.IsNotFound(err) {
+			c.logf("cache get %q: %s", key, err)
+		}
+		e = nil
+	}
+	if e != nil {
+		age := timeNow(c.TimeFunc).Sub(e.Stored)
+		if age < parseCacheControl(e.Header).maxAge() {
+			atomic.AddInt64(&c.hits, 1)
+			return e.response(req), nil
+		}
+		if !e.validatable() {
+			e = nil
+		}
+	}
+
+	if e != nil {
+		req = req.Clone(req.Context())
+		if etag := e.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if t := e.Header.Get("Last-Modified"); t != "" {
+			req.Header.Set("If-Modified-Since", t)
+		}
+	}
+
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if e != nil && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		for k, vs := range resp.Header {
+			e.Header[k] = vs
+		}
+		e.Stored = timeNow(c.TimeFunc)
+		c.put(key, e)
+		atomic.AddInt64(&c.revalidated, 1)
+		return e.response(req), nil
+	}
+
+	atomic.AddInt64(&c.misses, 1)
+	return c.save(key, resp)
+}
+
+func (c *Cache) save(key string, resp *http.Response) (*http.Response, error) {
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+	cc := parseCacheControl(resp.Header)
+	if cc.has("no-store") {
+		if err := c.store.Delete(key); err != nil {
+			c.logf("cache delete %q: %s", key, err)
+		}
+		return resp, nil
+	}
+	e := &CacheEntry{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Stored:     timeNow(c.TimeFunc),
+	}
+	if cc.maxAge() <= 0 && !e.validatable() {
+		return resp, nil
+	}
+
+	max := c.maxEntrySize()
+	if resp.ContentLength > max {
+		return resp, nil
+	}
+	bs, err := ioutil.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if int64(len(bs)) > max {
+		// Too large to cache; hands the body back as is.
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(bs), resp.Body), resp.Body}
+		return resp, nil
+	}
+	if err := resp.Body.Close(); err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(bs))
+
+	e.Body = bs
+	c.put(key, e)
+	return resp, nil
+}
@@ -0,0 +1,214 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httputil
+
+import (
+	"container/list"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"shanhu.io/misc/errcode"
+	"shanhu.io/misc/hashutil"
+	"shanhu.io/misc/tempfile"
+)
+
+// CacheEntry is a cached response.
+type CacheEntry struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+
+	// Stored is the time when the response was received or last
+	// revalidated.
+	Stored time.Time
+}
+
+func copyCacheEntry(e *CacheEntry) *CacheEntry {
+	cp := *e
+	cp.Header = e.Header.Clone()
+	return &cp
+}
+
+// CacheStore stores cached responses.
+type CacheStore interface {
+	// Get returns the entry of the given key. It returns a not-found
+	// error if the entry does not exist.
+	Get(key string) (*CacheEntry, error)
+
+	// Put saves the entry of the given key, replacing the old one.
+	Put(key string, e *CacheEntry) error
+
+	// Delete removes the entry of the given key, if any.
+	Delete(key string) error
+}
+
+// DefaultMemCacheMaxEntries is the default limit of the number of entries
+// in a MemCacheStore.
+const DefaultMemCacheMaxEntries = 1000
+
+type memCacheItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+// MemCacheStore is a cache store in memory. When it holds more entries
+// than the limit, the least recently used ones are evicted.
+type MemCacheStore struct {
+	// MaxEntries is the limit of the number of entries.
+	// DefaultMemCacheMaxEntries is used when it is 0.
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // Of *memCacheItem, most recently used first.
+}
+
+// NewMemCacheStore creates a new cache store in memory.
+func NewMemCacheStore() *MemCacheStore {
+	return &MemCacheStore{
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+func (s *MemCacheStore) maxEntries() int {
+	if s.MaxEntries <= 0 {
+		return DefaultMemCacheMaxEntries
+	}
+	return s.MaxEntries
+}
+
+// Get returns the entry of the given key.
+func (s *MemCacheStore) Get(key string) (*CacheEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, errcode.NotFoundf("cache entry not found")
+	}
+	s.lru.MoveToFront(elem)
+	return copyCacheEntry(elem.Value.(*memCacheItem).entry), nil
+}
+
+// Put saves the entry of the given key, and evicts the least recently used
+// entries if the store is full.
+func (s *MemCacheStore) Put(key string, e *CacheEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item := &memCacheItem{key: key, entry: copyCacheEntry(e)}
+	if elem, ok := s.entries[key]; ok {
+		elem.Value = item
+		s.lru.MoveToFront(elem)
+	} else {
+		s.entries[key] = s.lru.PushFront(item)
+	}
+	for max := s.maxEntries(); s.lru.Len() > max; {
+		back := s.lru.Back()
+		s.lru.Remove(back)
+		delete(s.entries, back.Value.(*memCacheItem).key)
+	}
+	return nil
+}
+
+// Delete removes the entry of the given key.
+func (s *MemCacheStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.entries[key]; ok {
+		s.lru.Remove(elem)
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// DiskCacheStore is a cache store that saves each entry as a JSON file in
+// a directory. Entries are written atomically, so the store can be shared
+// by multiple processes.
+type DiskCacheStore struct {
+	dir string
+}
+
+// NewDiskCacheStore creates a cache store in the given directory. The
+// directory is created if it does not exist.
+func NewDiskCacheStore(dir string) (*DiskCacheStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DiskCacheStore{dir: dir}, nil
+}
+
+func (s *DiskCacheStore) file(key string) string {
+	return filepath.Join(s.dir, hashutil.HashStr(key))
+}
+
+// Get returns the entry of the given key.
+func (s *DiskCacheStore) Get(key string) (*CacheEntry, error) {
+	bs, err := ioutil.ReadFile(s.file(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errcode.NotFoundf("cache entry not found")
+		}
+		return nil, err
+	}
+	e := new(CacheEntry)
+	if err := json.Unmarshal(bs, e); err != nil {
+		// A corrupted entry is as good as a missing one.
+		return nil, errcode.NotFoundf("decode cache entry: %s", err)
+	}
+	return e, nil
+}
+
+// Put saves the entry of the given key.
+func (s *DiskCacheStore) Put(key string, e *CacheEntry) error {
+	bs, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	f, err := tempfile.NewFile(s.dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	defer f.CleanUp()
+
+	if _, err := f.Write(bs); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := f.Rename(s.file(key)); err != nil {
+		return err
+	}
+	f.SkipCleanUp = true
+	return nil
+}
+
+// Delete removes the entry of the given key.
+func (s *DiskCacheStore) Delete(key string) error {
+	if err := os.Remove(s.file(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httputil
+
+import (
+	"testing"
+
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type cacheTestServer struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (s *cacheTestServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	s.calls[req.URL.Path]++
+	s.mu.Unlock()
+
+	h := w.Header()
+	switch req.URL.Path {
+	case "/fresh":
+		h.Set("Cache-Control", "max-age=60")
+	case "/etag":
+		h.Set("ETag", `"v1"`)
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	case "/modified":
+		const t = "Thu, 01 Jul 2021 00:00:00 GMT"
+		h.Set("Last-Modified", t)
+		if req.Header.Get("If-Modified-Since") == t {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	case "/nostore":
+		h.Set("Cache-Control", "no-store")
+		h.Set("ETag", `"v1"`)
+	}
+	w.Write([]byte(req.URL.Path))
+}
+
+func (s *cacheTestServer) count(p string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[p]
+}
+
+func testCache(t *testing.T, store CacheStore) {
+	s := &cacheTestServer{calls: make(map[string]int)}
+	c := newTestClient(t, s)
+	now := time.Unix(1600000000, 0)
+	c.Cache = NewCache(store)
+	c.Cache.TimeFunc = func() time.Time { return now }
+
+	get := func(p string) {
+		t.Helper()
+		got, err := c.GetString(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != p {
+			t.Errorf("get %q, got %q", p, got)
+		}
+	}
+
+	for _, p := range []string{"/fresh", "/etag", "/modified", "/nostore"} {
+		get(p)
+		get(p)
+	}
+	for p, want := range map[string]int{
+		"/fresh":    1,
+		"/etag":     2,
+		"/modified": 2,
+		"/nostore":  2,
+	} {
+		if got := s.count(p); got != want {
+			t.Errorf("%q got %d calls, want %d", p, got, want)
+		}
+	}
+
+	now = now.Add(time.Minute)
+	get("/fresh")
+	if got := s.count("/fresh"); got != 2 {
+		t.Errorf("stale entry got %d calls, want 2", got)
+	}
+
+	want := &CacheStats{Hits: 1, Revalidated: 2, Misses: 6}
+	if got := c.Cache.Stats(); *got != *want {
+		t.Errorf("got stats %+v, want %+v", got, want)
+	}
+}
+
+func TestMemCache(t *testing.T) {
+	testCache(t, NewMemCacheStore())
+}
+
+func TestDiskCache(t *testing.T) {
+	store, err := NewDiskCacheStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCache(t, store)
+}
+
+type brokenCacheStore struct{}
+
+func (brokenCacheStore) Get(key string) (*CacheEntry, error) {
+	return nil, errors.New("disk on fire")
+}
+
+func (brokenCacheStore) Put(key string, e *CacheEntry) error {
+	return errors.New("disk on fire")
+}
+
+func (brokenCacheStore) Delete(key string) error {
+	return errors.New("disk on fire")
+}
+
+func TestCacheStoreErrors(t *testing.T) {
+	s := &cacheTestServer{calls: make(map[string]int)}
+	c := newTestClient(t, s)
+	c.Cache = NewCache(brokenCacheStore{})
+	var logs int
+	c.Cache.Logf = func(string, ...interface{}) { logs++ }
+
+	for _, p := range []string{"/fresh", "/nostore"} {
+		got, err := c.GetString(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != p {
+			t.Errorf("get %q, got %q", p, got)
+		}
+	}
+	if logs == 0 {
+		t.Error("store errors are not logged")
+	}
+}
+
+func TestDiskCacheCorrupted(t *testing.T) {
+	s := &cacheTestServer{calls: make(map[string]int)}
+	c := newTestClient(t, s)
+	dir := t.TempDir()
+	store, err := NewDiskCacheStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Cache = NewCache(store)
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetString("/fresh"); err != nil {
+			t.Fatal(err)
+		}
+		if i != 0 {
+			continue
+		}
+		files, err := filepath.Glob(filepath.Join(dir, "*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range files {
+			if err := ioutil.WriteFile(f, []byte("{"), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// The corrupted entry is a miss, and is overwritten.
+	if got := s.count("/fresh"); got != 2 {
+		t.Errorf("got %d calls, want 2", got)
+	}
+}
+
+func TestMemCacheStoreEviction(t *testing.T) {
+	s := NewMemCacheStore()
+	s.MaxEntries = 2
+
+	put := func(key string) {
+		t.Helper()
+		if err := s.Put(key, &CacheEntry{StatusCode: 200}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	put("a")
+	put("b")
+	if _, err := s.Get("a"); err != nil {
+		t.Fatal(err)
+	}
+	put("c") // Evicts b, the least recently used.
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		_, err := s.Get(key)
+		if got := err == nil; got != want {
+			t.Errorf("entry %q exists is %t, want %t", key, got, want)
+		}
+	}
+}
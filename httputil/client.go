@@ -17,17 +17,28 @@ package httputil
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
+
+	"shanhu.io/misc/errcode"
 )
 
 // Client performs client that calls to a remote server with an optional token.
 type Client struct {
 	Server *url.URL
 
+	// Auth is the optional authenticator for adding credentials to
+	// requests. When it is set, TokenSource and Token are not used.
+	// Credentials are added right before a request is sent on Transport,
+	// after the middlewares, so signatures cover the request as sent.
+	// Requests redirected to other hosts are sent without credentials.
+	Auth Authenticator
+
 	// TokenSource is an optional token source to proivde bearer token.
 	TokenSource TokenSource
 	// Token is the optional token to use a bearer token, used only when
@@ -38,9 +49,32 @@ type Client struct {
 	Accept    string // Optional Accept header.
 
 	Transport http.RoundTripper
+
+	// Middleware is the optional chain of middlewares that wraps Transport.
+	// The first one sees each request first.
+	Middleware []Middleware
+
+	// Cache is the optional cache for GET requests. It sits between the
+	// middlewares and Transport.
+	Cache *Cache
+
+	// RateLimit is the optional limit on the requests sent to servers.
+	// Requests served from Cache are not limited.
+	RateLimit *RateLimit
+
+	// Retry is the optional policy for retrying requests that failed with
+	// transient errors. Requests are not retried when it is nil.
+	Retry *RetryPolicy
 }
 
 func (c *Client) addAuth(req *http.Request) error {
+	if req.URL.Host != c.Server.Host {
+		// Redirected to another host; credentials are only for the server.
+		return nil
+	}
+	if c.Auth != nil {
+		return c.Auth.Authenticate(req)
+	}
 	if c.TokenSource != nil {
 		ctx := req.Context()
 		tok, err := c.TokenSource.Token(ctx)
@@ -60,7 +94,17 @@ func (c *Client) addHeaders(h http.Header) {
 }
 
 func (c *Client) makeClient() *http.Client {
-	return &http.Client{Transport: c.Transport}
+	t := Chain(c.Transport, RequestHook(c.addAuth))
+	if c.RateLimit != nil {
+		t = Chain(t, c.RateLimit.Wrap)
+	}
+	if c.Cache != nil {
+		t = Chain(t, c.Cache.Wrap)
+	}
+	if len(c.Middleware) > 0 {
+		t = Chain(t, c.Middleware...)
+	}
+	return &http.Client{Transport: t}
 }
 
 func (c *Client) doRaw(req *http.Request) (*http.Response, error) {
@@ -68,6 +112,29 @@ func (c *Client) doRaw(req *http.Request) (*http.Response, error) {
 }
 
 func (c *Client) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.doRetry(req)
+	if ErrorStatusCode(err) != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	retry, rerr := c.reauth(req)
+	if rerr != nil {
+		return nil, errcode.Annotate(rerr, "refresh credentials")
+	}
+	if retry == nil {
+		return nil, err
+	}
+	return c.doRetry(retry)
+}
+
+func (c *Client) doRetry(req *http.Request) (*http.Response, error) {
+	if c.Retry != nil {
+		return c.Retry.do(req, c.doOnce)
+	}
+	return c.doOnce(req)
+}
+
+func (c *Client) doOnce(req *http.Request) (*http.Response, error) {
 	resp, err := c.doRaw(req)
 	if err != nil {
 		return nil, err
@@ -79,25 +146,26 @@ func (c *Client) do(req *http.Request) (*http.Response, error) {
 	return resp, nil
 }
 
-func (c *Client) req(m, p string, r io.Reader) (*http.Request, error) {
+func (c *Client) req(
+	ctx context.Context, m, p string, r io.Reader,
+) (*http.Request, error) {
 	u, err := makeURL(c.Server, p)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest(m, u, r)
+	req, err := http.NewRequestWithContext(ctx, m, u, r)
 	if err != nil {
 		return nil, err
 	}
-	if err := c.addAuth(req); err != nil {
-		return nil, err
-	}
 	c.addHeaders(req.Header)
 	return req, nil
 }
 
-func (c *Client) reqJSON(m, p string, r io.Reader) (*http.Request, error) {
-	req, err := c.req(m, p, r)
+func (c *Client) reqJSON(
+	ctx context.Context, m, p string, r io.Reader,
+) (*http.Request, error) {
+	req, err := c.req(ctx, m, p, r)
 	if err != nil {
 		return nil, err
 	}
@@ -107,7 +175,13 @@ func (c *Client) reqJSON(m, p string, r io.Reader) (*http.Request, error) {
 
 // Put puts a stream to a path on the server.
 func (c *Client) Put(p string, r io.Reader) error {
-	req, err := c.req(http.MethodPut, p, r)
+	return c.PutContext(context.Background(), p, r)
+}
+
+// PutContext puts a stream to a path on the server, using the given context
+// for the request.
+func (c *Client) PutContext(ctx context.Context, p string, r io.Reader) error {
+	req, err := c.req(ctx, http.MethodPut, p, r)
 	if err != nil {
 		return err
 	}
@@ -121,20 +195,36 @@ func (c *Client) Put(p string, r io.Reader) error {
 
 // PutBytes puts bytes to a path on the server.
 func (c *Client) PutBytes(p string, bs []byte) error {
-	return c.Put(p, bytes.NewBuffer(bs))
+	return c.PutBytesContext(context.Background(), p, bs)
+}
+
+// PutBytesContext puts bytes to a path on the server, using the given
+// context for the request.
+func (c *Client) PutBytesContext(
+	ctx context.Context, p string, bs []byte,
+) error {
+	return c.PutContext(ctx, p, bytes.NewBuffer(bs))
 }
 
 // JSONPut puts an object in JSON encoding.
 func (c *Client) JSONPut(p string, v interface{}) error {
+	return c.JSONPutContext(context.Background(), p, v)
+}
+
+// JSONPutContext puts an object in JSON encoding, using the given context
+// for the request.
+func (c *Client) JSONPutContext(
+	ctx context.Context, p string, v interface{},
+) error {
 	bs, err := json.Marshal(v)
 	if err != nil {
 		return err
 	}
-	return c.PutBytes(p, bs)
+	return c.PutBytesContext(ctx, p, bs)
 }
 
-func (c *Client) poke(m, p string) error {
-	req, err := c.req(m, p, nil)
+func (c *Client) poke(ctx context.Context, m, p string) error {
+	req, err := c.req(ctx, m, p, nil)
 	if err != nil {
 		return err
 	}
@@ -149,7 +239,13 @@ func (c *Client) poke(m, p string) error {
 // GetCode gets a response from a route and returns the
 // status code.
 func (c *Client) GetCode(p string) (int, error) {
-	req, err := c.req(http.MethodGet, p, nil)
+	return c.GetCodeContext(context.Background(), p)
+}
+
+// GetCodeContext gets a response from a route and returns the status code,
+// using the given context for the request.
+func (c *Client) GetCodeContext(ctx context.Context, p string) (int, error) {
+	req, err := c.req(ctx, http.MethodGet, p, nil)
 	if err != nil {
 		return 0, err
 	}
@@ -164,12 +260,27 @@ func (c *Client) GetCode(p string) (int, error) {
 
 // Poke posts a signal to the given route on the server.
 func (c *Client) Poke(p string) error {
-	return c.poke(http.MethodPost, p)
+	return c.PokeContext(context.Background(), p)
+}
+
+// PokeContext posts a signal to the given route on the server, using the
+// given context for the request.
+func (c *Client) PokeContext(ctx context.Context, p string) error {
+	return c.poke(ctx, http.MethodPost, p)
 }
 
 // Get gets a response from a route on the server.
 func (c *Client) Get(p string) (*http.Response, error) {
-	req, err := c.req(http.MethodGet, p, nil)
+	return c.GetContext(context.Background(), p)
+}
+
+// GetContext gets a response from a route on the server, using the given
+// context for the request. The context also covers reading the response
+// body.
+func (c *Client) GetContext(
+	ctx context.Context, p string,
+) (*http.Response, error) {
+	req, err := c.req(ctx, http.MethodGet, p, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -178,7 +289,15 @@ func (c *Client) Get(p string) (*http.Response, error) {
 
 // GetString gets the string response from a route on the server.
 func (c *Client) GetString(p string) (string, error) {
-	resp, err := c.Get(p)
+	return c.GetStringContext(context.Background(), p)
+}
+
+// GetStringContext gets the string response from a route on the server,
+// using the given context for the request.
+func (c *Client) GetStringContext(
+	ctx context.Context, p string,
+) (string, error) {
+	resp, err := c.GetContext(ctx, p)
 	if err != nil {
 		return "", err
 	}
@@ -189,7 +308,15 @@ func (c *Client) GetString(p string) (string, error) {
 // GetInto gets the specified path and writes everything from the body to the
 // given writer.
 func (c *Client) GetInto(p string, w io.Writer) (int64, error) {
-	resp, err := c.Get(p)
+	return c.GetIntoContext(context.Background(), p, w)
+}
+
+// GetIntoContext gets the specified path and writes everything from the
+// body to the given writer, using the given context for the request.
+func (c *Client) GetIntoContext(
+	ctx context.Context, p string, w io.Writer,
+) (int64, error) {
+	resp, err := c.GetContext(ctx, p)
 	if err != nil {
 		return 0, err
 	}
@@ -199,7 +326,15 @@ func (c *Client) GetInto(p string, w io.Writer) (int64, error) {
 
 // GetBytes gets the byte array from a route on the server.
 func (c *Client) GetBytes(p string) ([]byte, error) {
-	resp, err := c.Get(p)
+	return c.GetBytesContext(context.Background(), p)
+}
+
+// GetBytesContext gets the byte array from a route on the server, using the
+// given context for the request.
+func (c *Client) GetBytesContext(
+	ctx context.Context, p string,
+) ([]byte, error) {
+	resp, err := c.GetContext(ctx, p)
 	if err != nil {
 		return nil, err
 	}
@@ -210,9 +345,17 @@ func (c *Client) GetBytes(p string) ([]byte, error) {
 // JSONGet gets the content of a path and decodes the response
 // into resp as JSON.
 func (c *Client) JSONGet(p string, resp interface{}) error {
-	req, err := c.reqJSON(http.MethodGet, p, nil)
+	return c.JSONGetContext(context.Background(), p, resp)
+}
+
+// JSONGetContext gets the content of a path and decodes the response into
+// resp as JSON, using the given context for the request.
+func (c *Client) JSONGetContext(
+	ctx context.Context, p string, resp interface{},
+) error {
+	req, err := c.reqJSON(ctx, http.MethodGet, p, nil)
 	if err != nil {
-		return nil
+		return err
 	}
 	httpResp, err := c.do(req)
 	if err != nil {
@@ -241,10 +384,18 @@ func copyRespBody(resp *http.Response, w io.Writer) error {
 // Post posts with request body from r, and copies the response body
 // to w.
 func (c *Client) Post(p string, r io.Reader, w io.Writer) error {
+	return c.PostContext(context.Background(), p, r, w)
+}
+
+// PostContext posts with request body from r, and copies the response body
+// to w, using the given context for the request.
+func (c *Client) PostContext(
+	ctx context.Context, p string, r io.Reader, w io.Writer,
+) error {
 	if r != nil {
 		r = ioutil.NopCloser(r)
 	}
-	req, err := c.req(http.MethodPost, p, r)
+	req, err := c.req(ctx, http.MethodPost, p, r)
 	if err != nil {
 		return err
 	}
@@ -255,13 +406,16 @@ func (c *Client) Post(p string, r io.Reader, w io.Writer) error {
 	return copyRespBody(resp, w)
 }
 
-func (c *Client) jsonPost(p string, req interface{}) (*http.Response, error) {
+func (c *Client) jsonPost(
+	ctx context.Context, p string, req interface{},
+) (*http.Response, error) {
 	bs, err := json.Marshal(req)
 	if err != nil {
 		return nil, err
 	}
 
-	httpReq, err := c.reqJSON(http.MethodPost, p, bytes.NewBuffer(bs))
+	body := bytes.NewBuffer(bs)
+	httpReq, err := c.reqJSON(ctx, http.MethodPost, p, body)
 	if err != nil {
 		return nil, err
 	}
@@ -271,20 +425,22 @@ func (c *Client) jsonPost(p string, req interface{}) (*http.Response, error) {
 // JSONPost posts a JSON object as the request body and writes the body
 // into the given writer.
 func (c *Client) JSONPost(p string, req interface{}, w io.Writer) error {
-	resp, err := c.jsonPost(p, req)
+	return c.JSONPostContext(context.Background(), p, req, w)
+}
+
+// JSONPostContext posts a JSON object as the request body and writes the
+// body into the given writer, using the given context for the request.
+func (c *Client) JSONPostContext(
+	ctx context.Context, p string, req interface{}, w io.Writer,
+) error {
+	resp, err := c.jsonPost(ctx, p, req)
 	if err != nil {
 		return err
 	}
 	return copyRespBody(resp, w)
 }
 
-// JSONCall performs a call with the request as a marshalled JSON object,
-// and the response unmarhsalled as a JSON object.
-func (c *Client) JSONCall(p string, req, resp interface{}) error {
-	httpResp, err := c.jsonPost(p, req)
-	if err != nil {
-		return err
-	}
+func decodeJSONResp(httpResp *http.Response, resp interface{}) error {
 	defer httpResp.Body.Close()
 
 	if resp == nil {
@@ -297,12 +453,69 @@ func (c *Client) JSONCall(p string, req, resp interface{}) error {
 	return httpResp.Body.Close()
 }
 
+// JSONCall performs a call with the request as a marshalled JSON object,
+// and the response unmarhsalled as a JSON object.
+func (c *Client) JSONCall(p string, req, resp interface{}) error {
+	return c.JSONCallContext(context.Background(), p, req, resp)
+}
+
+// JSONCallContext performs a call with the request as a marshalled JSON
+// object, and the response unmarhsalled as a JSON object, using the given
+// context for the request.
+func (c *Client) JSONCallContext(
+	ctx context.Context, p string, req, resp interface{},
+) error {
+	httpResp, err := c.jsonPost(ctx, p, req)
+	if err != nil {
+		return err
+	}
+	return decodeJSONResp(httpResp, resp)
+}
+
+// FormCall performs a call with the request as a URL encoded form, and the
+// response unmarshalled as a JSON object.
+func (c *Client) FormCall(p string, form url.Values, resp interface{}) error {
+	return c.FormCallContext(context.Background(), p, form, resp)
+}
+
+// FormCallContext performs a call with the request as a URL encoded form,
+// and the response unmarshalled as a JSON object, using the given context
+// for the request.
+func (c *Client) FormCallContext(
+	ctx context.Context, p string, form url.Values, resp interface{},
+) error {
+	body := strings.NewReader(form.Encode())
+	req, err := c.req(ctx, http.MethodPost, p, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpResp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	return decodeJSONResp(httpResp, resp)
+}
+
 // Call is an alias to JSONCall.
 func (c *Client) Call(p string, req, resp interface{}) error {
 	return c.JSONCall(p, req, resp)
 }
 
+// CallContext is an alias to JSONCallContext.
+func (c *Client) CallContext(
+	ctx context.Context, p string, req, resp interface{},
+) error {
+	return c.JSONCallContext(ctx, p, req, resp)
+}
+
 // Delete sends a delete message to the particular path.
 func (c *Client) Delete(p string) error {
-	return c.poke(http.MethodDelete, p)
+	return c.DeleteContext(context.Background(), p)
+}
+
+// DeleteContext sends a delete message to the particular path, using the
+// given context for the request.
+func (c *Client) DeleteContext(ctx context.Context, p string) error {
+	return c.poke(ctx, http.MethodDelete, p)
 }
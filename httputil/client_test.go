@@ -18,9 +18,26 @@ package httputil
 import (
 	"testing"
 
+	"context"
+	"errors"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 )
 
+// newTestClient starts a test server that serves with h, and returns a
+// client of it. The server is closed when the test finishes.
+func newTestClient(t *testing.T, h http.Handler) *Client {
+	s := httptest.NewServer(h)
+	t.Cleanup(s.Close)
+
+	c, err := NewClient(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
 func TestClientGetCode(t *testing.T) {
 	s := newHelloServer()
 	c, err := NewClient(s.URL)
@@ -63,3 +80,46 @@ func TestClientGet(t *testing.T) {
 		t.Errorf("got %q, want %q", string(got), testHelloMessage)
 	}
 }
+
+type ctxTokenSource struct{}
+
+type ctxTokenKey struct{}
+
+func (ctxTokenSource) Token(ctx context.Context) (string, error) {
+	tok, _ := ctx.Value(ctxTokenKey{}).(string)
+	return tok, nil
+}
+
+func TestClientContext(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	c := newTestClient(t, http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/block" {
+				<-block
+				return
+			}
+			tok, _ := BearerToken(req.Header)
+			w.Write([]byte(tok))
+		},
+	))
+	c.TokenSource = ctxTokenSource{}
+
+	ctx := context.WithValue(context.Background(), ctxTokenKey{}, "tok")
+	got, err := c.GetStringContext(ctx, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "tok" {
+		t.Errorf("got token %q, want %q", got, "tok")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go cancel()
+	if err := c.PokeContext(ctx, "/block"); err == nil {
+		t.Error("poke with canceled context, got nil error")
+	} else if !errors.Is(err, context.Canceled) {
+		t.Errorf("poke with canceled context, got %v", err)
+	}
+}
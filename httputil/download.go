@@ -0,0 +1,239 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"shanhu.io/misc/hashutil"
+	"shanhu.io/misc/tempfile"
+)
+
+// DownloadOptions contains the options for downloading a file.
+type DownloadOptions struct {
+	// SHA256 is the optional expected sha256 hash of the file in hex.
+	SHA256 string
+
+	// Progress is the optional callback that reports the number of bytes
+	// of the file that are downloaded, including the resumed part.
+	Progress ProgressFunc
+}
+
+// Download downloads the content of a path into a file. The content is
+// first written into a partial file with a ".part" suffix, which is
+// renamed into place after the download completes and the hash checks.
+// If a previous download left a partial file, the download resumes from
+// its end with a Range request. The ETag or Last-Modified validator of the
+// content is saved next to the partial file, and sent in If-Range, so that
+// the download starts over if the content has changed.
+func (c *Client) Download(p, file string, opts *DownloadOptions) error {
+	return c.DownloadContext(context.Background(), p, file, opts)
+}
+
+// DownloadContext downloads the content of a path into a file, using the
+// given context for the requests.
+func (c *Client) DownloadContext(
+	ctx context.Context, p, file string, opts *DownloadOptions,
+) error {
+	if opts == nil {
+		opts = new(DownloadOptions)
+	}
+
+	partName := file + ".part"
+	validatorFile := partName + ".validator"
+	f, err := os.OpenFile(partName, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	part := &tempfile.File{File: f, Name: partName}
+
+	if err := c.downloadPart(ctx, p, part, validatorFile, opts); err != nil {
+		part.Close()
+		return err
+	}
+	if err := part.Close(); err != nil {
+		return err
+	}
+
+	if opts.SHA256 != "" {
+		got, err := hashutil.HashFile(partName)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(got, opts.SHA256) {
+			part.Remove()
+			removeValidator(validatorFile)
+			return fmt.Errorf(
+				"sha256 mismatch for %q: got %s, want %s",
+				p, got, opts.SHA256,
+			)
+		}
+	}
+	if err := part.Rename(file); err != nil {
+		return err
+	}
+	return removeValidator(validatorFile)
+}
+
+func (c *Client) downloadPart(
+	ctx context.Context, p string, part *tempfile.File, validatorFile string,
+	opts *DownloadOptions,
+) error {
+	offset, err := part.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	var validator string
+	if offset > 0 {
+		validator = readValidator(validatorFile)
+		if validator == "" {
+			offset = 0 // Cannot tell if the content has changed.
+		}
+	}
+
+	resp, err := c.getRange(ctx, p, offset, validator)
+	const badRange = http.StatusRequestedRangeNotSatisfiable
+	if offset > 0 && ErrorStatusCode(err) == badRange {
+		if total, ok := errorContentRangeTotal(err); ok && total == offset {
+			// The partial file already has all the content.
+			if opts.Progress != nil {
+				opts.Progress(offset, total)
+			}
+			return nil
+		}
+		// The partial file is not a prefix of the content; start over.
+		offset = 0
+		resp, err = c.getRange(ctx, p, 0, "")
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if offset > 0 && resp.StatusCode != http.StatusPartialContent {
+		// The content has changed, or Range is not supported; start over.
+		offset = 0
+	}
+	if offset > 0 {
+		start, ok := contentRangeStart(resp.Header)
+		if !ok || start != offset {
+			return fmt.Errorf(
+				"got content range %q, want start at %d",
+				resp.Header.Get("Content-Range"), offset,
+			)
+		}
+	}
+	if offset == 0 {
+		if err := part.Truncate(0); err != nil {
+			return err
+		}
+		v := respValidator(resp.Header)
+		if err := writeValidator(validatorFile, v); err != nil {
+			return err
+		}
+	}
+	if _, err := part.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	w := newProgressWriter(part, offset, total, opts.Progress)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// respValidator returns the validator of the content for If-Range. Weak
+// entity tags cannot be used in If-Range.
+func respValidator(h http.Header) string {
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return h.Get("Last-Modified")
+}
+
+func readValidator(f string) string {
+	bs, err := ioutil.ReadFile(f)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(bs))
+}
+
+func writeValidator(f, v string) error {
+	if v == "" {
+		return removeValidator(f)
+	}
+	return ioutil.WriteFile(f, []byte(v), 0644)
+}
+
+func removeValidator(f string) error {
+	if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func contentRangeStart(h http.Header) (int64, bool) {
+	var start int64
+	v := h.Get("Content-Range")
+	if _, err := fmt.Sscanf(v, "bytes %d-", &start); err != nil {
+		return 0, false
+	}
+	return start, true
+}
+
+// errorContentRangeTotal returns the total size of the content in the
+// Content-Range header of an unsatisfiable range reply.
+func errorContentRangeTotal(err error) (int64, bool) {
+	herr := new(httpError)
+	if !errors.As(err, &herr) || herr.Header == nil {
+		return 0, false
+	}
+	var total int64
+	v := herr.Header.Get("Content-Range")
+	if _, err := fmt.Sscanf(v, "bytes */%d", &total); err != nil {
+		return 0, false
+	}
+	return total, true
+}
+
+func (c *Client) getRange(
+	ctx context.Context, p string, offset int64, validator string,
+) (*http.Response, error) {
+	req, err := c.req(ctx, http.MethodGet, p, nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if validator != "" {
+			req.Header.Set("If-Range", validator)
+		}
+	}
+	return c.do(req)
+}
@@ -0,0 +1,185 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httputil
+
+import (
+	"testing"
+
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"shanhu.io/misc/hashutil"
+)
+
+type rangeServer struct {
+	content string
+	etag    string
+	ranges  []string
+}
+
+func (s *rangeServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.ranges = append(s.ranges, req.Header.Get("Range"))
+	if s.etag != "" {
+		w.Header().Set("ETag", s.etag)
+	}
+	r := strings.NewReader(s.content)
+	http.ServeContent(w, req, "", time.Time{}, r)
+}
+
+func newDownloadTest(t *testing.T, content string) (
+	*Client, *rangeServer, string,
+) {
+	rs := &rangeServer{content: content, etag: `"v1"`}
+	return newTestClient(t, rs), rs, filepath.Join(t.TempDir(), "file")
+}
+
+func checkFile(t *testing.T, file, want string) {
+	t.Helper()
+	bs, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bs) != want {
+		t.Errorf("got %q, want %q", bs, want)
+	}
+	for _, f := range []string{file + ".part", file + ".part.validator"} {
+		if _, err := os.Stat(f); !os.IsNotExist(err) {
+			t.Errorf("%q not removed: %v", f, err)
+		}
+	}
+}
+
+func writePart(t *testing.T, file, content, validator string) {
+	t.Helper()
+	part := file + ".part"
+	if err := ioutil.WriteFile(part, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if validator == "" {
+		return
+	}
+	v := []byte(validator)
+	if err := ioutil.WriteFile(part+".validator", v, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientDownload(t *testing.T) {
+	const content = "hello, world"
+	c, _, file := newDownloadTest(t, content)
+
+	var done, total int64
+	opts := &DownloadOptions{
+		SHA256: hashutil.HashStr(content),
+		Progress: func(d, t int64) {
+			done, total = d, t
+		},
+	}
+	if err := c.Download("/", file, opts); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, file, content)
+	if n := int64(len(content)); done != n || total != n {
+		t.Errorf("got progress %d/%d, want %d/%d", done, total, n, n)
+	}
+}
+
+func TestClientDownloadResume(t *testing.T) {
+	const content = "hello, world"
+	c, rs, file := newDownloadTest(t, content)
+
+	writePart(t, file, "hello", `"v1"`)
+	if err := c.Download("/", file, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, file, content)
+	if len(rs.ranges) != 1 || rs.ranges[0] != "bytes=5-" {
+		t.Errorf("got ranges %q, want [bytes=5-]", rs.ranges)
+	}
+}
+
+func TestClientDownloadResumeChanged(t *testing.T) {
+	const content = "jello, world"
+	c, rs, file := newDownloadTest(t, content)
+
+	writePart(t, file, "hello", `"v0"`)
+	if err := c.Download("/", file, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, file, content)
+	if len(rs.ranges) != 1 {
+		t.Errorf("got ranges %q, want 1 request", rs.ranges)
+	}
+}
+
+func TestClientDownloadResumeNoValidator(t *testing.T) {
+	const content = "jello, world"
+	c, rs, file := newDownloadTest(t, content)
+
+	writePart(t, file, "hello", "")
+	if err := c.Download("/", file, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, file, content)
+	if len(rs.ranges) != 1 || rs.ranges[0] != "" {
+		t.Errorf("got ranges %q, want one full request", rs.ranges)
+	}
+}
+
+func TestClientDownloadResumeComplete(t *testing.T) {
+	const content = "hello, world"
+	c, rs, file := newDownloadTest(t, content)
+
+	writePart(t, file, content, `"v1"`)
+	if err := c.Download("/", file, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, file, content)
+	if len(rs.ranges) != 1 {
+		t.Errorf("got ranges %q, want 1 request", rs.ranges)
+	}
+}
+
+func TestClientDownloadRestart(t *testing.T) {
+	const content = "hello"
+	c, _, file := newDownloadTest(t, content)
+
+	writePart(t, file, "hello, world", `"v1"`)
+	if err := c.Download("/", file, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, file, content)
+}
+
+func TestClientDownloadHashMismatch(t *testing.T) {
+	c, _, file := newDownloadTest(t, "hello")
+
+	opts := &DownloadOptions{SHA256: hashutil.HashStr("bye")}
+	if err := c.Download("/", file, opts); err == nil {
+		t.Fatal("want hash mismatch error, got nil")
+	}
+	for _, f := range []string{
+		file, file + ".part", file + ".part.validator",
+	} {
+		if _, err := os.Stat(f); !os.IsNotExist(err) {
+			t.Errorf("%q should not exist, got %v", f, err)
+		}
+	}
+}
@@ -16,10 +16,16 @@
 package httputil
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"log"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"shanhu.io/misc/errcode"
 )
@@ -32,9 +38,19 @@ type httpError struct {
 	StatusCode int
 	Status     string
 	Body       string
+
+	// Message is the error message of a structured JSON error reply.
+	Message string
+
+	RetryAfter time.Duration // Parsed from the Retry-After header.
+
+	Header http.Header // Header of the reply.
 }
 
 func (err *httpError) Error() string {
+	if err.Message != "" {
+		return err.Message
+	}
 	if err.Body != "" {
 		return fmt.Sprintf("%s - %s", err.Status, err.Body)
 	}
@@ -43,13 +59,45 @@ func (err *httpError) Error() string {
 
 // ErrorStatusCode returns the status code is it is an HTTP error.
 func ErrorStatusCode(err error) int {
-	herr, ok := err.(*httpError)
-	if !ok {
+	herr := new(httpError)
+	if !errors.As(err, &herr) {
 		return 0
 	}
 	return herr.StatusCode
 }
 
+func errorRetryAfter(err error) time.Duration {
+	herr := new(httpError)
+	if !errors.As(err, &herr) {
+		return 0
+	}
+	return herr.RetryAfter
+}
+
+// parseRetryAfter parses the Retry-After header, which is either a number
+// of seconds or an HTTP date. It returns 0 when the header is missing or
+// invalid.
+func parseRetryAfter(h http.Header, now time.Time) time.Duration {
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if sec <= 0 {
+			return 0
+		}
+		return time.Duration(sec) * time.Second
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0
+	}
+	if d := t.Sub(now); d > 0 {
+		return d
+	}
+	return 0
+}
+
 // AddErrCode adds error code to an error given the http status.
 func AddErrCode(statusCode int, err error) error {
 	switch statusCode {
@@ -59,11 +107,90 @@ func AddErrCode(statusCode int, err error) error {
 		err = errcode.Add(errcode.Unauthorized, err)
 	case http.StatusBadRequest:
 		err = errcode.Add(errcode.InvalidArg, err)
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		err = errcode.Add(errcode.TimeOut, err)
+	case http.StatusInternalServerError:
+		err = errcode.Add(errcode.Internal, err)
 	}
 	return err
 }
 
-// RespError returns the error from an HTTP response.
+// ErrorResponse is the JSON body of an error reply written by WriteError.
+type ErrorResponse struct {
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+// ErrCodeStatus returns the HTTP status code for an error based on its
+// error code. Errors without a known code are internal server errors.
+func ErrCodeStatus(err error) int {
+	switch errcode.Of(err) {
+	case errcode.NotFound:
+		return http.StatusNotFound
+	case errcode.InvalidArg:
+		return http.StatusBadRequest
+	case errcode.Unauthorized:
+		return http.StatusUnauthorized
+	case errcode.TimeOut:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// WriteError writes err as a JSON error reply, with the status code given
+// by ErrCodeStatus. The reply is parsed back into an *errcode.Error with
+// the same code and message by RespError. Internal errors and errors
+// without a code are logged, and replied with a generic message, so that
+// their details are not leaked to the client.
+func WriteError(w http.ResponseWriter, err error) {
+	writeError(w, ErrCodeStatus(err), err)
+}
+
+func errorResponse(err error) *ErrorResponse {
+	code := errcode.Of(err)
+	if code == "" || code == errcode.Internal {
+		log.Println(err)
+		return &ErrorResponse{
+			Code:    errcode.Internal,
+			Message: "internal error",
+		}
+	}
+	return &ErrorResponse{Code: code, Message: err.Error()}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	resp := errorResponse(err)
+	bs, jsonErr := json.Marshal(resp)
+	if jsonErr != nil {
+		http.Error(w, resp.Message, http.StatusInternalServerError)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(append(bs, '\n'))
+}
+
+func parseErrorResponse(h http.Header, body []byte) *ErrorResponse {
+	t, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil || t != "application/json" {
+		return nil
+	}
+	resp := new(ErrorResponse)
+	if err := json.Unmarshal(body, resp); err != nil {
+		return nil
+	}
+	if resp.Message == "" {
+		return nil
+	}
+	return resp
+}
+
+// RespError returns the error from an HTTP response. If the response is a
+// JSON error reply written by WriteError, the returned error carries the
+// error code and message in the reply. Otherwise, the error code is derived
+// from the status code.
 func RespError(resp *http.Response) error {
 	bs, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -73,6 +200,14 @@ func RespError(resp *http.Response) error {
 		StatusCode: resp.StatusCode,
 		Status:     resp.Status,
 		Body:       strings.TrimSpace(string(bs)),
+		RetryAfter: parseRetryAfter(resp.Header, time.Now()),
+		Header:     resp.Header,
+	}
+	if errResp := parseErrorResponse(resp.Header, bs); errResp != nil {
+		herr.Message = errResp.Message
+		if errResp.Code != "" {
+			return errcode.Add(errResp.Code, herr)
+		}
 	}
 	return AddErrCode(resp.StatusCode, herr)
 }
@@ -0,0 +1,101 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httputil
+
+import (
+	"testing"
+
+	"errors"
+	"net/http"
+
+	"shanhu.io/misc/errcode"
+)
+
+func TestWriteErrorRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		err    error
+		status int
+		code   string
+		msg    string
+	}{{
+		err:    errcode.NotFoundf("no such file"),
+		status: http.StatusNotFound,
+	}, {
+		err:    errcode.InvalidArgf("bad name"),
+		status: http.StatusBadRequest,
+	}, {
+		err:    errcode.Unauthorizedf("who are you"),
+		status: http.StatusUnauthorized,
+	}, {
+		err:    errcode.TimeOutf("took too long"),
+		status: http.StatusGatewayTimeout,
+	}, {
+		err:    errcode.Errorf("custom", "custom"),
+		status: http.StatusInternalServerError,
+	}, {
+		err:    errcode.Internalf("database down"),
+		status: http.StatusInternalServerError,
+		code:   errcode.Internal,
+		msg:    "internal error",
+	}, {
+		err:    errors.New("database down"),
+		status: http.StatusInternalServerError,
+		code:   errcode.Internal,
+		msg:    "internal error",
+	}} {
+		err := test.err
+		c := newTestClient(t, http.HandlerFunc(
+			func(w http.ResponseWriter, req *http.Request) {
+				WriteError(w, err)
+			},
+		))
+		got := c.Poke("/")
+
+		if got == nil {
+			t.Errorf("%q: got nil error", err)
+			continue
+		}
+		wantCode := test.code
+		if wantCode == "" {
+			wantCode = errcode.Of(err)
+		}
+		if code := errcode.Of(got); code != wantCode {
+			t.Errorf("%q: got code %q, want %q", err, code, wantCode)
+		}
+		wantMsg := test.msg
+		if wantMsg == "" {
+			wantMsg = err.Error()
+		}
+		if got.Error() != wantMsg {
+			t.Errorf("got message %q, want %q", got.Error(), wantMsg)
+		}
+		if code := ErrorStatusCode(got); code != test.status {
+			t.Errorf("%q: got status %d, want %d", err, code, test.status)
+		}
+	}
+}
+
+func TestRespErrorPlainText(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			http.Error(w, "timed out", http.StatusGatewayTimeout)
+		},
+	))
+	got := c.Poke("/")
+	if !errcode.IsTimeOut(got) {
+		t.Errorf("got %q, want a time-out error", got)
+	}
+}
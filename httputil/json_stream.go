@@ -0,0 +1,241 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httputil
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// JSONStreamError is an error in decoding a JSON stream.
+type JSONStreamError struct {
+	Offset int64 // Offset in the stream where the error happens.
+	Err    error
+}
+
+func (err *JSONStreamError) Error() string {
+	return fmt.Sprintf("json stream at offset %d: %s", err.Offset, err.Err)
+}
+
+// Unwrap returns the underlying decoding error.
+func (err *JSONStreamError) Unwrap() error { return err.Err }
+
+// JSONStream is an iterator over a stream of JSON values, which is either
+// newline-delimited JSON (NDJSON) or the elements of a top-level JSON array.
+// Values are decoded one at a time, so memory use is bounded by the size of
+// the largest value rather than the whole stream. The underlying reader is
+// closed when the stream ends or fails.
+type JSONStream struct {
+	r     io.ReadCloser
+	dec   *json.Decoder
+	base  int64 // Bytes skipped before the decoder starts.
+	array bool
+
+	started bool
+	done    bool
+	err     error
+}
+
+func newJSONStream(r io.ReadCloser, br io.Reader, array bool) *JSONStream {
+	return &JSONStream{
+		r:     r,
+		dec:   json.NewDecoder(br),
+		array: array,
+	}
+}
+
+// NewNDJSONStream creates a stream that reads newline-delimited JSON
+// values from r.
+func NewNDJSONStream(r io.ReadCloser) *JSONStream {
+	return newJSONStream(r, r, false)
+}
+
+// NewJSONArrayStream creates a stream that reads the elements of a
+// top-level JSON array from r.
+func NewJSONArrayStream(r io.ReadCloser) *JSONStream {
+	return newJSONStream(r, r, true)
+}
+
+func isJSONSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
+
+// NewJSONStream creates a stream that reads JSON values from r. If the
+// stream starts with '[', it reads the elements of a top-level JSON array.
+// Otherwise, it reads newline-delimited JSON values.
+func NewJSONStream(r io.ReadCloser) *JSONStream {
+	br := bufio.NewReader(r)
+	var skipped int64
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			// Empty stream or read error; let the decoder report it.
+			s := newJSONStream(r, br, false)
+			s.base = skipped
+			return s
+		}
+		if !isJSONSpace(b) {
+			br.UnreadByte()
+			s := newJSONStream(r, br, b == '[')
+			s.base = skipped
+			return s
+		}
+		skipped++
+	}
+}
+
+func (s *JSONStream) offset() int64 {
+	return s.base + s.dec.InputOffset()
+}
+
+func (s *JSONStream) fail(offset int64, err error) bool {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	syntaxErr := new(json.SyntaxError)
+	if errors.As(err, &syntaxErr) {
+		offset = s.base + syntaxErr.Offset
+	}
+	s.err = &JSONStreamError{Offset: offset, Err: err}
+	s.finish()
+	return false
+}
+
+func (s *JSONStream) finish() {
+	s.done = true
+	if err := s.r.Close(); err != nil && s.err == nil {
+		s.err = err
+	}
+}
+
+// Next decodes the next value in the stream into v. It returns false when
+// the stream ends or fails, after which Err reports the error, if any.
+func (s *JSONStream) Next(v interface{}) bool {
+	if s.done {
+		return false
+	}
+
+	if s.array && !s.started {
+		s.started = true
+		tok, err := s.dec.Token()
+		if err != nil {
+			return s.fail(s.offset(), err)
+		}
+		if d, ok := tok.(json.Delim); !ok || d != '[' {
+			err := fmt.Errorf("expect '[', got %v", tok)
+			return s.fail(s.offset(), err)
+		}
+	}
+
+	if s.array && !s.dec.More() {
+		if _, err := s.dec.Token(); err != nil { // The closing ']'.
+			return s.fail(s.offset(), err)
+		}
+		s.finish()
+		return false
+	}
+
+	start := s.offset()
+	if err := s.dec.Decode(v); err != nil {
+		if err == io.EOF && !s.array {
+			s.finish()
+			return false
+		}
+		return s.fail(start, err)
+	}
+	return true
+}
+
+// Err returns the error that stops the stream. It returns nil if the
+// stream ended normally.
+func (s *JSONStream) Err() error { return s.err }
+
+// Close stops the stream and closes the underlying reader. It is safe to
+// call Close after the stream ends.
+func (s *JSONStream) Close() error {
+	if s.done {
+		return nil
+	}
+	s.done = true
+	return s.r.Close()
+}
+
+func isNDJSONType(t string) bool {
+	switch t {
+	case "application/x-ndjson", "application/ndjson",
+		"application/jsonl", "application/x-jsonlines":
+		return true
+	}
+	return false
+}
+
+func respJSONStream(resp *http.Response) *JSONStream {
+	t, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err == nil && isNDJSONType(t) {
+		return NewNDJSONStream(resp.Body)
+	}
+	return NewJSONStream(resp.Body)
+}
+
+// JSONGetStream gets the content of a path as a stream of JSON values.
+// The caller should iterate the stream until it ends, or close it.
+func (c *Client) JSONGetStream(p string) (*JSONStream, error) {
+	return c.JSONGetStreamContext(context.Background(), p)
+}
+
+// JSONGetStreamContext gets the content of a path as a stream of JSON
+// values, using the given context for the request. The context also covers
+// reading the stream.
+func (c *Client) JSONGetStreamContext(
+	ctx context.Context, p string,
+) (*JSONStream, error) {
+	req, err := c.reqJSON(ctx, http.MethodGet, p, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return respJSONStream(resp), nil
+}
+
+// JSONCallStream performs a call with the request as a marshalled JSON
+// object, and returns the response as a stream of JSON values.
+func (c *Client) JSONCallStream(p string, req interface{}) (
+	*JSONStream, error,
+) {
+	return c.JSONCallStreamContext(context.Background(), p, req)
+}
+
+// JSONCallStreamContext performs a call with the request as a marshalled
+// JSON object, and returns the response as a stream of JSON values, using
+// the given context for the request.
+func (c *Client) JSONCallStreamContext(
+	ctx context.Context, p string, req interface{},
+) (*JSONStream, error) {
+	resp, err := c.jsonPost(ctx, p, req)
+	if err != nil {
+		return nil, err
+	}
+	return respJSONStream(resp), nil
+}
@@ -0,0 +1,156 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httputil
+
+import (
+	"testing"
+
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+type testEvent struct {
+	N int
+}
+
+type closeCounter struct {
+	io.Reader
+	closed int
+}
+
+func (c *closeCounter) Close() error {
+	c.closed++
+	return nil
+}
+
+func readEvents(s *JSONStream) []int {
+	var got []int
+	for {
+		ev := new(testEvent)
+		if !s.Next(ev) {
+			return got
+		}
+		got = append(got, ev.N)
+	}
+}
+
+func TestJSONStream(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		want  []int
+	}{
+		{``, nil},
+		{`{"N":1}`, []int{1}},
+		{"{\"N\":1}\n{\"N\":2}\n\n{\"N\":3}\n", []int{1, 2, 3}},
+		{` [{"N":1}, {"N":2}]`, []int{1, 2}},
+		{`[]`, nil},
+	} {
+		r := &closeCounter{Reader: strings.NewReader(test.input)}
+		s := NewJSONStream(r)
+		got := readEvents(s)
+		if err := s.Err(); err != nil {
+			t.Errorf("stream %q: got error: %s", test.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("stream %q: got %v, want %v", test.input, got, test.want)
+		}
+		if r.closed != 1 {
+			t.Errorf("stream %q: closed %d times", test.input, r.closed)
+		}
+		if err := s.Close(); err != nil || r.closed != 1 {
+			t.Errorf("stream %q: close after end failed", test.input)
+		}
+	}
+}
+
+func TestJSONStreamError(t *testing.T) {
+	for _, test := range []struct {
+		input  string
+		offset int64
+		n      int
+	}{
+		{"{\"N\":1}\n{\"N\":x}\n", 14, 1},
+		{`[{"N":1},{"N":2}`, 16, 2},
+		{`[{"N":1},{"N":"x"}]`, 8, 1},
+	} {
+		r := &closeCounter{Reader: strings.NewReader(test.input)}
+		s := NewJSONStream(r)
+		got := readEvents(s)
+		if len(got) != test.n {
+			t.Errorf(
+				"stream %q: got %d values, want %d",
+				test.input, len(got), test.n,
+			)
+		}
+		streamErr := new(JSONStreamError)
+		if !errors.As(s.Err(), &streamErr) {
+			t.Errorf("stream %q: got error %v", test.input, s.Err())
+			continue
+		}
+		if streamErr.Offset != test.offset {
+			t.Errorf(
+				"stream %q: got offset %d, want %d",
+				test.input, streamErr.Offset, test.offset,
+			)
+		}
+		if r.closed != 1 {
+			t.Errorf("stream %q: closed %d times", test.input, r.closed)
+		}
+	}
+}
+
+func TestClientJSONGetStream(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			bs, _ := ioutil.ReadAll(req.Body)
+			if len(bs) > 0 {
+				w.Write(bs)
+				w.Write([]byte("\n"))
+			}
+			w.Write([]byte("{\"N\":1}\n{\"N\":2}\n"))
+		},
+	))
+
+	stream, err := c.JSONGetStream("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := readEvents(stream)
+	if err := stream.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	stream, err = c.JSONCallStream("/", &testEvent{N: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = readEvents(stream)
+	if err := stream.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{0, 1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
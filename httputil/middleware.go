@@ -0,0 +1,209 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httputil
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"shanhu.io/misc/rand"
+)
+
+// RoundTripperFunc is an adapter to use a function as an http.RoundTripper.
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req).
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (
+	*http.Response, error,
+) {
+	return f(req)
+}
+
+// Middleware wraps a round tripper to intercept the requests that go
+// through it. A middleware must not modify the request in place; it should
+// clone the request first.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// Chain wraps t with the middlewares. The first middleware is the
+// outermost one, which sees the request first and the response last.
+func Chain(t http.RoundTripper, mids ...Middleware) http.RoundTripper {
+	if t == nil {
+		t = http.DefaultTransport
+	}
+	for i := len(mids) - 1; i >= 0; i-- {
+		t = mids[i](t)
+	}
+	return t
+}
+
+// RequestHook returns a middleware that calls f on a clone of each request
+// before it is sent. f may modify the request, for example to add headers.
+// If f returns an error, the request is not sent.
+func RequestHook(f func(req *http.Request) error) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (
+			*http.Response, error,
+		) {
+			req = req.Clone(req.Context())
+			if err := f(req); err != nil {
+				closeReqBody(req)
+				return nil, err
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// ResponseHook returns a middleware that calls f on each response that is
+// received. If f returns an error, the response body is closed and the
+// error is returned instead.
+func ResponseHook(f func(resp *http.Response) error) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (
+			*http.Response, error,
+		) {
+			resp, err := next.RoundTrip(req)
+			if err != nil {
+				return nil, err
+			}
+			if err := f(resp); err != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+			return resp, nil
+		})
+	}
+}
+
+// SetHeaders returns a middleware that sets the given headers on each
+// request, replacing existing values.
+func SetHeaders(h http.Header) Middleware {
+	return RequestHook(func(req *http.Request) error {
+		for k, v := range h {
+			req.Header[http.CanonicalHeaderKey(k)] = append([]string(nil), v...)
+		}
+		return nil
+	})
+}
+
+// RequestIDHeader is the header that carries the request ID.
+const RequestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context that carries a request ID. Servers can
+// use it to pass the ID of an incoming request to outgoing calls.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried in the context.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok && id != ""
+}
+
+// PropagateRequestID returns a middleware that sets the RequestIDHeader of
+// each request to the request ID in the request's context. When the context
+// does not carry a request ID, a random one is generated. Requests that
+// already have the header are left as is.
+func PropagateRequestID() Middleware {
+	return RequestHook(func(req *http.Request) error {
+		if req.Header.Get(RequestIDHeader) != "" {
+			return nil
+		}
+		id, ok := RequestIDFromContext(req.Context())
+		if !ok {
+			id = rand.HexBytes(8)
+		}
+		req.Header.Set(RequestIDHeader, id)
+		return nil
+	})
+}
+
+// LogRequests returns a middleware that logs the method, path, status and
+// latency of each request using logf. The latency covers the time until
+// the response header is received.
+func LogRequests(
+	logf func(format string, args ...interface{}),
+) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (
+			*http.Response, error,
+		) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			d := time.Since(start)
+			if err != nil {
+				logf("%s %s error: %s (%s)", req.Method, req.URL.Path, err, d)
+				return nil, err
+			}
+			logf("%s %s %d (%s)", req.Method, req.URL.Path, resp.StatusCode, d)
+			return resp, nil
+		})
+	}
+}
+
+func gzipBody(r io.ReadCloser) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		defer r.Close()
+		w := gzip.NewWriter(pw)
+		_, err := io.Copy(w, r)
+		if err == nil {
+			err = w.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// GzipRequests returns a middleware that compresses request bodies with
+// gzip, and sets the Content-Encoding header. The body is compressed as
+// it is sent, and stays replayable if the original body is. Requests that
+// have no body or already have a Content-Encoding are left as is.
+func GzipRequests() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (
+			*http.Response, error,
+		) {
+			if req.Body == nil || req.Body == http.NoBody ||
+				req.Header.Get("Content-Encoding") != "" {
+				return next.RoundTrip(req)
+			}
+
+			body := req.Body
+			req = req.Clone(req.Context())
+			req.Body = gzipBody(body)
+			req.ContentLength = -1
+			req.Header.Del("Content-Length")
+			req.Header.Set("Content-Encoding", "gzip")
+			if getBody := req.GetBody; getBody != nil {
+				req.GetBody = func() (io.ReadCloser, error) {
+					r, err := getBody()
+					if err != nil {
+						return nil, err
+					}
+					return gzipBody(r), nil
+				}
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
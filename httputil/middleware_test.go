@@ -0,0 +1,127 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httputil
+
+import (
+	"testing"
+
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+func echoHandler(w http.ResponseWriter, req *http.Request) {
+	body := req.Body
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		r, err := gzip.NewReader(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = r
+	}
+	bs, err := ioutil.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fmt.Fprintf(
+		w, "%s %s %s",
+		req.Header.Get("X-Test"), req.Header.Get(RequestIDHeader), bs,
+	)
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(echoHandler))
+
+	var order []string
+	mid := func(name string) Middleware {
+		return RequestHook(func(req *http.Request) error {
+			order = append(order, name)
+			req.Header.Set("X-Test", name)
+			return nil
+		})
+	}
+	c.Middleware = []Middleware{mid("outer"), mid("inner")}
+
+	got, err := c.GetString("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "inner  "; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if s := strings.Join(order, ","); s != "outer,inner" {
+		t.Errorf("got order %q", s)
+	}
+}
+
+func TestMiddlewareResponseHook(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(echoHandler))
+	hookErr := fmt.Errorf("rejected")
+	c.Middleware = []Middleware{
+		ResponseHook(func(resp *http.Response) error {
+			return hookErr
+		}),
+	}
+	if _, err := c.GetString("/"); err == nil {
+		t.Error("want error from response hook, got nil")
+	}
+}
+
+func TestMiddlewareBuiltins(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(echoHandler))
+
+	var logs []string
+	logf := func(f string, args ...interface{}) {
+		logs = append(logs, fmt.Sprintf(f, args...))
+	}
+	c.Middleware = []Middleware{
+		LogRequests(logf),
+		SetHeaders(http.Header{"X-Test": []string{"hi"}}),
+		PropagateRequestID(),
+		GzipRequests(),
+	}
+
+	ctx := WithRequestID(context.Background(), "req1")
+	var buf strings.Builder
+	if err := c.PostContext(
+		ctx, "/echo", strings.NewReader("body"), &buf,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "hi req1 body"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if len(logs) != 1 {
+		t.Fatalf("got %d log lines, want 1", len(logs))
+	}
+	if !strings.HasPrefix(logs[0], "POST /echo 200 ") {
+		t.Errorf("unexpected log line: %q", logs[0])
+	}
+
+	got, err := c.GetString("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields := strings.Fields(got); len(fields) != 2 || fields[1] == "" {
+		t.Errorf("want a generated request ID, got %q", got)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httputil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// MultipartFile is a file in a multipart upload.
+type MultipartFile struct {
+	Field    string // Name of the form field.
+	FileName string // Name of the file.
+
+	// ContentType is the optional content type of the file. It is
+	// application/octet-stream when empty.
+	ContentType string
+
+	// Reader provides the content of the file. It is read as the request
+	// is sent, and is not closed.
+	Reader io.Reader
+}
+
+// MultipartForm is a multipart/form-data request body, which contains
+// form fields followed by files.
+type MultipartForm struct {
+	Fields url.Values
+	Files  []*MultipartFile
+
+	// Progress is the optional callback that reports the number of bytes
+	// of the body that are sent. The total is always unknown. It is called
+	// from the goroutine that writes the body.
+	Progress ProgressFunc
+}
+
+var quoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+func (f *MultipartFile) header() textproto.MIMEHeader {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(
+		`form-data; name="%s"; filename="%s"`,
+		quoteEscaper.Replace(f.Field), quoteEscaper.Replace(f.FileName),
+	))
+	t := f.ContentType
+	if t == "" {
+		t = "application/octet-stream"
+	}
+	h.Set("Content-Type", t)
+	return h
+}
+
+func (f *MultipartForm) writeTo(w *multipart.Writer) error {
+	var keys []string
+	for k := range f.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range f.Fields[k] {
+			if err := w.WriteField(k, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, file := range f.Files {
+		part, err := w.CreatePart(file.header())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, file.Reader); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// PostMultipart posts the form as a multipart/form-data request body, and
+// copies the response body to w. The body is streamed as it is sent, so
+// files are never buffered in memory as a whole. As a result, the request
+// is not retried.
+func (c *Client) PostMultipart(
+	p string, form *MultipartForm, w io.Writer,
+) error {
+	return c.PostMultipartContext(context.Background(), p, form, w)
+}
+
+// PostMultipartContext posts the form as a multipart/form-data request
+// body, and copies the response body to w, using the given context for the
+// request.
+func (c *Client) PostMultipartContext(
+	ctx context.Context, p string, form *MultipartForm, w io.Writer,
+) error {
+	pr, pw := io.Pipe()
+	req, err := c.req(ctx, http.MethodPost, p, pr)
+	if err != nil {
+		pr.Close()
+		return err
+	}
+
+	mw := multipart.NewWriter(newProgressWriter(pw, 0, -1, form.Progress))
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	go func() {
+		pw.CloseWithError(form.writeTo(mw))
+	}()
+
+	resp, err := c.do(req)
+	pr.Close() // In case that the body is not fully read.
+	if err != nil {
+		return err
+	}
+	return copyRespBody(resp, w)
+}
@@ -0,0 +1,75 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httputil
+
+import (
+	"testing"
+
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+func TestClientPostMultipart(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			if err := req.ParseMultipartForm(1 << 20); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			f, h, err := req.FormFile("file")
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			defer f.Close()
+			bs, err := ioutil.ReadAll(f)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			fmt.Fprintf(
+				w, "%s %s %s", req.FormValue("name"), h.Filename, bs,
+			)
+		},
+	))
+
+	content := strings.Repeat("x", 100000)
+	var last int64
+	form := &MultipartForm{
+		Fields: url.Values{"name": []string{"alice"}},
+		Files: []*MultipartFile{{
+			Field:    "file",
+			FileName: "a.txt",
+			Reader:   strings.NewReader(content),
+		}},
+		Progress: func(done, total int64) { last = done },
+	}
+
+	out := new(bytes.Buffer)
+	if err := c.PostMultipart("/", form, out); err != nil {
+		t.Fatal(err)
+	}
+	if want := "alice a.txt " + content; out.String() != want {
+		t.Errorf("got reply of %d bytes, want %d", out.Len(), len(want))
+	}
+	if last <= int64(len(content)) {
+		t.Errorf("progress reported %d bytes, want more than content", last)
+	}
+}
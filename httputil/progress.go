@@ -0,0 +1,49 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httputil
+
+import (
+	"io"
+)
+
+// ProgressFunc reports the progress of a transfer, with the number of bytes
+// done so far, and the total number of bytes, which is -1 when unknown.
+type ProgressFunc func(done, total int64)
+
+type progressWriter struct {
+	w     io.Writer
+	done  int64
+	total int64
+	f     ProgressFunc
+}
+
+func newProgressWriter(
+	w io.Writer, done, total int64, f ProgressFunc,
+) io.Writer {
+	if f == nil {
+		return w
+	}
+	return &progressWriter{w: w, done: done, total: total, f: f}
+}
+
+func (w *progressWriter) Write(bs []byte) (int, error) {
+	n, err := w.w.Write(bs)
+	if n > 0 {
+		w.done += int64(n)
+		w.f(w.done, w.total)
+	}
+	return n, err
+}
@@ -0,0 +1,247 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httputil
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type tokenBucket struct {
+	rate   float64 // Tokens per second; 0 means unlimited.
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	pausedUntil time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// reserve takes a token, and returns how long the caller needs to wait
+// before using it. Tokens can be borrowed from the future, so concurrent
+// callers queue up in order.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	var wait time.Duration
+	if now.Before(b.pausedUntil) {
+		wait = b.pausedUntil.Sub(now)
+	}
+	if b.rate <= 0 {
+		return wait
+	}
+
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+	b.tokens--
+	if b.tokens < 0 {
+		d := time.Duration(-b.tokens / b.rate * float64(time.Second))
+		if d > wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// cancel returns a token that is reserved but not used.
+func (b *tokenBucket) cancel() {
+	if b.rate > 0 {
+		b.tokens++
+	}
+}
+
+func (b *tokenBucket) pause(until time.Time) {
+	if until.After(b.pausedUntil) {
+		b.pausedUntil = until
+	}
+}
+
+// RateLimit limits the requests that a client sends. It has a token bucket
+// for each host, and limits the number of requests in flight across all
+// hosts. When a host replies HTTP 429 with a Retry-After header, requests
+// to the host are paused until then. A RateLimit is safe to use by
+// multiple goroutines and clients.
+type RateLimit struct {
+	// Rate is the number of requests per second allowed for each host.
+	// There is no rate limit when it is 0.
+	Rate float64
+
+	// Burst is the number of requests allowed to send at once for each
+	// host. It is at least 1.
+	Burst int
+
+	// MaxInFlight is the maximum number of requests in flight. A request
+	// is in flight until its response body is closed. There is no limit
+	// when it is 0.
+	MaxInFlight int
+
+	// TimeFunc is an optional function for reading the current timestamp.
+	// When it is nil, time.Now() is used.
+	TimeFunc func() time.Time
+
+	// sleep waits for a reserved token; it is replaced in tests.
+	sleep func(ctx context.Context, d time.Duration) error
+
+	initOnce sync.Once
+	inFlight chan struct{}
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func (l *RateLimit) init() {
+	l.initOnce.Do(func() {
+		if l.MaxInFlight > 0 {
+			l.inFlight = make(chan struct{}, l.MaxInFlight)
+		}
+		l.buckets = make(map[string]*tokenBucket)
+	})
+}
+
+func (l *RateLimit) bucket(host string, now time.Time) *tokenBucket {
+	b, ok := l.buckets[host]
+	if !ok {
+		b = newTokenBucket(l.Rate, l.Burst, now)
+		l.buckets[host] = b
+	}
+	return b
+}
+
+func (l *RateLimit) wait(ctx context.Context, host string) error {
+	l.mu.Lock()
+	now := timeNow(l.TimeFunc)
+	b := l.bucket(host, now)
+	d := b.reserve(now)
+	l.mu.Unlock()
+
+	if d <= 0 {
+		return nil
+	}
+	sleep := l.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+	if err := sleep(ctx, d); err != nil {
+		l.mu.Lock()
+		b.cancel()
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *RateLimit) pause(host string, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := timeNow(l.TimeFunc)
+	l.bucket(host, now).pause(now.Add(d))
+}
+
+func (l *RateLimit) acquire(ctx context.Context) error {
+	if l.inFlight == nil {
+		return nil
+	}
+	select {
+	case l.inFlight <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *RateLimit) release() {
+	if l.inFlight != nil {
+		<-l.inFlight
+	}
+}
+
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// Wrap returns a round tripper that sends requests to next within the
+// limits. Its method value can be used as a Middleware.
+func (l *RateLimit) Wrap(next http.RoundTripper) http.RoundTripper {
+	l.init()
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		ctx := req.Context()
+		host := req.URL.Host
+		if err := l.wait(ctx, host); err != nil {
+			closeReqBody(req)
+			return nil, err
+		}
+		if err := l.acquire(ctx); err != nil {
+			closeReqBody(req)
+			return nil, err
+		}
+
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			l.release()
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			now := timeNow(l.TimeFunc)
+			if d := parseRetryAfter(resp.Header, now); d > 0 {
+				l.pause(host, d)
+			}
+		}
+		resp.Body = &releaseBody{ReadCloser: resp.Body, release: l.release}
+		return resp, nil
+	})
+}
+
+func closeReqBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httputil
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	b := newTokenBucket(10, 2, now)
+
+	for i, want := range []time.Duration{
+		0, 0, 100 * time.Millisecond, 200 * time.Millisecond,
+	} {
+		if got := b.reserve(now); got != want {
+			t.Errorf("reserve %d: got %s, want %s", i, got, want)
+		}
+	}
+
+	// Pays back the borrowed tokens, and refills the bucket.
+	now = now.Add(time.Second)
+	if got := b.reserve(now); got != 0 {
+		t.Errorf("reserve after refill: got %s, want 0", got)
+	}
+
+	b.pause(now.Add(3 * time.Second))
+	if got := b.reserve(now); got != 3*time.Second {
+		t.Errorf("reserve when paused: got %s, want 3s", got)
+	}
+
+	unlimited := newTokenBucket(0, 0, now)
+	for i := 0; i < 10; i++ {
+		if got := unlimited.reserve(now); got != 0 {
+			t.Fatalf("unlimited bucket got wait %s", got)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte("ok"))
+		},
+	))
+	now := time.Unix(1600000000, 0)
+	var waits []time.Duration
+	c.RateLimit = &RateLimit{
+		Rate:     50,
+		TimeFunc: func() time.Time { return now },
+		sleep: func(ctx context.Context, d time.Duration) error {
+			waits = append(waits, d)
+			return nil
+		},
+	}
+
+	for i := 0; i < 4; i++ {
+		if _, err := c.GetString("/"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []time.Duration{
+		20 * time.Millisecond, 40 * time.Millisecond, 60 * time.Millisecond,
+	}
+	if len(waits) != len(want) {
+		t.Fatalf("got waits %v, want %v", waits, want)
+	}
+	for i, d := range waits {
+		if diff := d - want[i]; diff < -time.Microsecond ||
+			diff > time.Microsecond {
+			t.Errorf("wait %d: got %s, want %s", i, d, want[i])
+		}
+	}
+}
+
+func TestRateLimitCanceled(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	l := &RateLimit{
+		Rate:     1,
+		TimeFunc: func() time.Time { return now },
+		sleep: func(ctx context.Context, d time.Duration) error {
+			return context.Canceled
+		},
+	}
+	l.init()
+
+	ctx := context.Background()
+	if err := l.wait(ctx, "host"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.wait(ctx, "host"); err != context.Canceled {
+		t.Fatalf("want canceled, got %v", err)
+	}
+	// The canceled wait gives its token back.
+	if d := l.buckets["host"].reserve(now); d != time.Second {
+		t.Errorf("got wait %s after cancel, want 1s", d)
+	}
+}
+
+func TestRateLimitInFlight(t *testing.T) {
+	var cur, max int64
+	c := newTestClient(t, http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			n := atomic.AddInt64(&cur, 1)
+			defer atomic.AddInt64(&cur, -1)
+			for {
+				m := atomic.LoadInt64(&max)
+				if n <= m || atomic.CompareAndSwapInt64(&max, m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			w.Write([]byte("ok"))
+		},
+	))
+	c.RateLimit = &RateLimit{MaxInFlight: 2}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.GetString("/"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt64(&max); n > 2 {
+		t.Errorf("got %d requests in flight, want at most 2", n)
+	}
+}
+
+func TestRateLimitTooManyRequests(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+		},
+	))
+	l := &RateLimit{}
+	c.RateLimit = l
+
+	if err := c.Poke("/"); ErrorStatusCode(err) != http.StatusTooManyRequests {
+		t.Fatalf("want 429 error, got %v", err)
+	}
+
+	host := c.Server.Host
+	l.mu.Lock()
+	d := l.buckets[host].reserve(time.Now())
+	l.mu.Unlock()
+	if d < 29*time.Second {
+		t.Errorf("got wait %s after 429, want about 30s", d)
+	}
+}
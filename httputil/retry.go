@@ -0,0 +1,213 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httputil
+
+import (
+	"context"
+	"errors"
+	"io"
+	mrand "math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"shanhu.io/misc/errcode"
+	"shanhu.io/misc/rand"
+)
+
+// Default values of RetryPolicy.
+const (
+	DefaultRetryAttempts   = 3
+	DefaultRetryMinBackoff = 100 * time.Millisecond
+	DefaultRetryMaxBackoff = 10 * time.Second
+)
+
+// RetryPolicy specifies how a client retries requests that failed with a
+// transient error, such as a reset connection or an HTTP 429, 502, 503 or
+// 504 reply.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts for a request,
+	// including the first one. DefaultRetryAttempts is used when it is 0.
+	MaxAttempts int
+
+	// MinBackoff is the backoff before the first retry. It doubles on each
+	// following retry, up to MaxBackoff. The actual wait is jittered
+	// between half of the backoff and the full backoff.
+	// DefaultRetryMinBackoff and DefaultRetryMaxBackoff are used when they
+	// are 0.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// NonIdempotent also retries requests with non-idempotent methods,
+	// such as POST. By default, those are only retried on HTTP 429, where
+	// the server rejected the request without processing it.
+	NonIdempotent bool
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts == 0 {
+		return DefaultRetryAttempts
+	}
+	return p.MaxAttempts
+}
+
+func (p *RetryPolicy) minBackoff() time.Duration {
+	if p.MinBackoff == 0 {
+		return DefaultRetryMinBackoff
+	}
+	return p.MinBackoff
+}
+
+func (p *RetryPolicy) maxBackoff() time.Duration {
+	if p.MaxBackoff == 0 {
+		return DefaultRetryMaxBackoff
+	}
+	return p.MaxBackoff
+}
+
+var jitter = struct {
+	sync.Mutex
+	r *mrand.Rand
+}{r: rand.New()}
+
+func jittered(d time.Duration) time.Duration {
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	jitter.Lock()
+	defer jitter.Unlock()
+	return half + time.Duration(jitter.r.Int63n(int64(half)+1))
+}
+
+// backoff returns the wait before the next attempt, or false if the
+// server asks to wait for longer than the maximum backoff.
+func (p *RetryPolicy) backoff(attempt int, err error) (time.Duration, bool) {
+	max := p.maxBackoff()
+	if d := errorRetryAfter(err); d > 0 {
+		return d, d <= max
+	}
+
+	d := p.minBackoff()
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return jittered(d), true
+}
+
+// IsIdempotentMethod checks if an HTTP method is idempotent as defined in
+// RFC 7231, and hence is safe to retry.
+func IsIdempotentMethod(m string) bool {
+	switch m {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions,
+		http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isTransportRetryable checks if err is a transport error that is likely
+// to be transient: a network time-out, a connection that is reset, refused
+// or closed before the reply is complete.
+func isTransportRetryable(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// IsRetryable checks if err is an error that is likely to be transient.
+// This includes HTTP 429, 502, 503 and 504 replies, time-out errors and
+// transport errors like a reset or refused connection. Context
+// cancellation, other HTTP replies and other errors are not retryable.
+func IsRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	switch ErrorStatusCode(err) {
+	case 0:
+		// Not an HTTP reply; the request failed in the transport.
+		if isTransportRetryable(err) {
+			return true
+		}
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return errcode.IsTimeOut(err)
+}
+
+func (p *RetryPolicy) shouldRetry(req *http.Request, err error) bool {
+	if !IsRetryable(err) {
+		return false
+	}
+	if p.NonIdempotent || IsIdempotentMethod(req.Method) {
+		return true
+	}
+	return ErrorStatusCode(err) == http.StatusTooManyRequests
+}
+
+func isReplayable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+func (p *RetryPolicy) do(
+	req *http.Request, f func(req *http.Request) (*http.Response, error),
+) (*http.Response, error) {
+	ctx := req.Context()
+	max := p.maxAttempts()
+	r := req
+	for attempt := 1; ; attempt++ {
+		resp, err := f(r)
+		if err == nil {
+			return resp, nil
+		}
+		if attempt >= max || !isReplayable(req) || !p.shouldRetry(req, err) {
+			return nil, err
+		}
+		wait, ok := p.backoff(attempt, err)
+		if !ok {
+			return nil, err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		r = req.Clone(ctx)
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r.Body = body
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httputil
+
+import (
+	"testing"
+
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type flakyServer struct {
+	mu     sync.Mutex
+	fails  int
+	code   int
+	bodies []string
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	bs, _ := ioutil.ReadAll(req.Body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bodies = append(s.bodies, string(bs))
+	if s.fails > 0 {
+		s.fails--
+		w.WriteHeader(s.code)
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+func (s *flakyServer) calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bodies
+}
+
+func testRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 3,
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  10 * time.Millisecond,
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	s := &flakyServer{fails: 2, code: http.StatusServiceUnavailable}
+	c := newTestClient(t, s)
+	c.Retry = testRetryPolicy()
+	if err := c.PutBytes("/", []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	calls := s.calls()
+	if len(calls) != 3 {
+		t.Fatalf("got %d calls, want 3", len(calls))
+	}
+	for i, body := range calls {
+		if body != "data" {
+			t.Errorf("call %d got body %q, want %q", i, body, "data")
+		}
+	}
+}
+
+func TestClientRetryGiveUp(t *testing.T) {
+	s := &flakyServer{fails: 5, code: http.StatusBadGateway}
+	c := newTestClient(t, s)
+	c.Retry = testRetryPolicy()
+	err := c.Delete("/")
+	if code := ErrorStatusCode(err); code != http.StatusBadGateway {
+		t.Errorf("got status %d, want %d", code, http.StatusBadGateway)
+	}
+	if n := len(s.calls()); n != 3 {
+		t.Errorf("got %d calls, want 3", n)
+	}
+}
+
+func TestClientRetryNonIdempotent(t *testing.T) {
+	s := &flakyServer{fails: 1, code: http.StatusServiceUnavailable}
+	c := newTestClient(t, s)
+	c.Retry = testRetryPolicy()
+	if err := c.JSONCall("/", "req", nil); err == nil {
+		t.Error("post on 503 got retried")
+	}
+
+	s = &flakyServer{fails: 1, code: http.StatusTooManyRequests}
+	c = newTestClient(t, s)
+	c.Retry = testRetryPolicy()
+	if err := c.JSONCall("/", "req", nil); err != nil {
+		t.Errorf("post on 429 not retried: %s", err)
+	}
+}
+
+func TestClientRetryNotRetryable(t *testing.T) {
+	s := &flakyServer{fails: 1, code: http.StatusNotFound}
+	c := newTestClient(t, s)
+	c.Retry = testRetryPolicy()
+	if err := c.Poke("/"); err == nil {
+		t.Error("want error, got nil")
+	}
+	if n := len(s.calls()); n != 1 {
+		t.Errorf("got %d calls, want 1", n)
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+func TestIsRetryable(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		want bool
+	}{
+		{timeoutError{}, true},
+		{fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		{io.EOF, true},
+		{&net.OpError{Op: "read", Err: syscall.ECONNRESET}, true},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{errors.New("unsupported protocol scheme"), false},
+		{&httpError{StatusCode: http.StatusServiceUnavailable}, true},
+		{&httpError{StatusCode: http.StatusBadRequest}, false},
+	} {
+		if got := IsRetryable(test.err); got != test.want {
+			t.Errorf(
+				"IsRetryable(%v), got %t, want %t",
+				test.err, got, test.want,
+			)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		v    string
+		want time.Duration
+	}{
+		{"", 0},
+		{"3", 3 * time.Second},
+		{"-1", 0},
+		{"Thu, 01 Jul 2021 00:00:10 GMT", 10 * time.Second},
+		{"Wed, 30 Jun 2021 00:00:00 GMT", 0},
+		{"soon", 0},
+	} {
+		h := make(http.Header)
+		if test.v != "" {
+			h.Set("Retry-After", test.v)
+		}
+		got := parseRetryAfter(h, now)
+		if got != test.want {
+			t.Errorf("Retry-After %q, got %s, want %s", test.v, got, test.want)
+		}
+	}
+}
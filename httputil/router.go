@@ -0,0 +1,169 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httputil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+
+	"shanhu.io/misc/errcode"
+)
+
+// DefaultMaxBodySize is the default size limit of request bodies that a
+// Router accepts.
+const DefaultMaxBodySize = 1 << 20
+
+// Validator is an optional interface for request types of a Router. After
+// a request is decoded, the router calls Validate, and replies with the
+// error if it fails. Errors without an error code are invalid-arg errors.
+type Validator interface {
+	Validate() error
+}
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+type jsonHandler struct {
+	f   reflect.Value
+	req reflect.Type // Element type of the request pointer.
+}
+
+func newJSONHandler(f interface{}) (*jsonHandler, error) {
+	v := reflect.ValueOf(f)
+	t := v.Type()
+	if t.Kind() != reflect.Func {
+		return nil, fmt.Errorf("handler is %s, not a function", t)
+	}
+	if t.NumIn() != 2 || t.In(0) != contextType ||
+		t.In(1).Kind() != reflect.Ptr {
+		return nil, fmt.Errorf(
+			"handler %s does not take (context.Context, *Req)", t,
+		)
+	}
+	if t.NumOut() != 2 || t.Out(1) != errorType {
+		return nil, fmt.Errorf(
+			"handler %s does not return (*Resp, error)", t,
+		)
+	}
+	return &jsonHandler{f: v, req: t.In(1).Elem()}, nil
+}
+
+// Router routes JSON calls, like the ones that Client.Call sends, to typed
+// handlers. A handler is a function with the signature of
+// func(ctx context.Context, req *Req) (*Resp, error). The request body is
+// decoded into a new Req and validated, and the returned Resp is encoded
+// as the response body. Returned errors are written with WriteError, so
+// their error codes are mapped to HTTP status codes.
+type Router struct {
+	// MaxBodySize is the size limit of request bodies. Requests with
+	// larger bodies are rejected. DefaultMaxBodySize is used when it is 0.
+	MaxBodySize int64
+
+	handlers map[string]*jsonHandler
+}
+
+// NewRouter creates a new router with no handlers.
+func NewRouter() *Router {
+	return &Router{handlers: make(map[string]*jsonHandler)}
+}
+
+// Handle registers the handler f on path p. It panics if f does not have
+// the handler signature, or if p already has a handler.
+func (r *Router) Handle(p string, f interface{}) {
+	h, err := newJSONHandler(f)
+	if err != nil {
+		panic(fmt.Sprintf("httputil: route %q: %s", p, err))
+	}
+	if _, ok := r.handlers[p]; ok {
+		panic(fmt.Sprintf("httputil: route %q registered twice", p))
+	}
+	r.handlers[p] = h
+}
+
+func (r *Router) maxBodySize() int64 {
+	if r.MaxBodySize == 0 {
+		return DefaultMaxBodySize
+	}
+	return r.MaxBodySize
+}
+
+func (r *Router) decode(req *http.Request, v interface{}) (int, error) {
+	max := r.maxBodySize()
+	body := &io.LimitedReader{R: req.Body, N: max + 1}
+	err := json.NewDecoder(body).Decode(v)
+	if body.N <= 0 {
+		return http.StatusRequestEntityTooLarge, errcode.InvalidArgf(
+			"request body larger than %d bytes", max,
+		)
+	}
+	if err != nil && err != io.EOF { // An empty body is a zero request.
+		return http.StatusBadRequest, errcode.InvalidArgf(
+			"decode request: %s", err,
+		)
+	}
+
+	if validator, ok := v.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			if errcode.Of(err) == "" {
+				err = errcode.Add(errcode.InvalidArg, err)
+			}
+			return ErrCodeStatus(err), err
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// ServeHTTP serves the JSON calls. Calls must use the POST method.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h, ok := r.handlers[req.URL.Path]
+	if !ok {
+		WriteError(w, errcode.NotFoundf("route %q not found", req.URL.Path))
+		return
+	}
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		err := errcode.InvalidArgf("method %q not allowed", req.Method)
+		writeError(w, http.StatusMethodNotAllowed, err)
+		return
+	}
+
+	reqValue := reflect.New(h.req)
+	if status, err := r.decode(req, reqValue.Interface()); err != nil {
+		writeError(w, status, err)
+		return
+	}
+
+	ctx := reflect.ValueOf(req.Context())
+	out := h.f.Call([]reflect.Value{ctx, reqValue})
+	if err, _ := out[1].Interface().(error); err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	bs, err := json.Marshal(out[0].Interface())
+	if err != nil {
+		WriteError(w, errcode.Internalf("encode response: %s", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(bs, '\n'))
+}
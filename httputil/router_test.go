@@ -0,0 +1,154 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httputil
+
+import (
+	"testing"
+
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"shanhu.io/misc/errcode"
+)
+
+type testGreetRequest struct {
+	Name string
+}
+
+func (r *testGreetRequest) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is empty")
+	}
+	return nil
+}
+
+type testGreetResponse struct {
+	Greeting string
+}
+
+func testGreet(
+	ctx context.Context, req *testGreetRequest,
+) (*testGreetResponse, error) {
+	switch req.Name {
+	case "nobody":
+		return nil, errcode.NotFoundf("%q not found", req.Name)
+	case "db":
+		return nil, fmt.Errorf("connect to db at 10.0.0.1")
+	}
+	return &testGreetResponse{Greeting: "hello " + req.Name}, nil
+}
+
+func newTestRouter() *Router {
+	r := NewRouter()
+	r.MaxBodySize = 100
+	r.Handle("/greet", testGreet)
+	return r
+}
+
+func TestRouter(t *testing.T) {
+	c := newTestClient(t, newTestRouter())
+
+	resp := new(testGreetResponse)
+	req := &testGreetRequest{Name: "alice"}
+	if err := c.Call("/greet", req, resp); err != nil {
+		t.Fatal(err)
+	}
+	if want := "hello alice"; resp.Greeting != want {
+		t.Errorf("got %q, want %q", resp.Greeting, want)
+	}
+
+	for _, test := range []struct {
+		p      string
+		req    interface{}
+		status int
+		code   string
+	}{
+		{
+			"/greet", &testGreetRequest{},
+			http.StatusBadRequest, errcode.InvalidArg,
+		},
+		{"/greet", "bad", http.StatusBadRequest, errcode.InvalidArg},
+		{
+			"/greet", &testGreetRequest{Name: "nobody"},
+			http.StatusNotFound, errcode.NotFound,
+		},
+		{
+			"/greet", &testGreetRequest{Name: strings.Repeat("x", 100)},
+			http.StatusRequestEntityTooLarge, errcode.InvalidArg,
+		},
+		{
+			"/nothing", &testGreetRequest{},
+			http.StatusNotFound, errcode.NotFound,
+		},
+		{
+			"/greet", &testGreetRequest{Name: "db"},
+			http.StatusInternalServerError, errcode.Internal,
+		},
+	} {
+		err := c.Call(test.p, test.req, nil)
+		if got := ErrorStatusCode(err); got != test.status {
+			t.Errorf(
+				"call %q with %v: got status %d, want %d",
+				test.p, test.req, got, test.status,
+			)
+		}
+		if got := errcode.Of(err); got != test.code {
+			t.Errorf(
+				"call %q with %v: got code %q, want %q",
+				test.p, test.req, got, test.code,
+			)
+		}
+	}
+
+	err := c.Call("/greet", &testGreetRequest{Name: "db"}, nil)
+	if err == nil || strings.Contains(err.Error(), "10.0.0.1") {
+		t.Errorf("internal error details leaked: %v", err)
+	}
+
+	code, err := c.GetCode("/greet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != http.StatusMethodNotAllowed {
+		t.Errorf("get got status %d, want 405", code)
+	}
+}
+
+func TestRouterBadHandler(t *testing.T) {
+	for _, f := range []interface{}{
+		"not a function",
+		func(req *testGreetRequest) (*testGreetResponse, error) {
+			return nil, nil
+		},
+		func(ctx context.Context, req testGreetRequest) error {
+			return nil
+		},
+		func(ctx context.Context, req *testGreetRequest) *testGreetResponse {
+			return nil
+		},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("handler %T registered without panic", f)
+				}
+			}()
+			NewRouter().Handle("/", f)
+		}()
+	}
+}
@@ -18,6 +18,7 @@ package httputil
 import (
 	"context"
 	"net/http"
+	"strings"
 )
 
 // SetAuthToken sets authorization header token.
@@ -28,6 +29,17 @@ func SetAuthToken(h http.Header, tok string) {
 	h.Set("Authorization", "Bearer "+tok)
 }
 
+// BearerToken returns the bearer token in the authorization header.
+func BearerToken(h http.Header) (string, bool) {
+	const prefix = "bearer "
+	v := h.Get("Authorization")
+	if len(v) <= len(prefix) || !strings.EqualFold(v[:len(prefix)], prefix) {
+		return "", false
+	}
+	tok := strings.TrimSpace(v[len(prefix):])
+	return tok, tok != ""
+}
+
 // TokenSource is an interface that can provides a bearer token for
 // authentication.
 type TokenSource interface {
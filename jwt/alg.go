@@ -19,9 +19,26 @@ package jwt
 const (
 	AlgHS256 = "HS256" // HMAC + SHA256
 	AlgRS256 = "RS256" // RSA + SHA256
+	AlgES256 = "ES256" // ECDSA P-256 + SHA256
+	AlgEdDSA = "EdDSA" // Ed25519
+)
+
+// Key management algorithm codes for JWE.
+const (
+	AlgDir        = "dir"          // Direct use of a shared symmetric key.
+	AlgRSAOAEP256 = "RSA-OAEP-256" // RSA OAEP + SHA256
+)
+
+// Content encryption algorithm codes for JWE.
+const (
+	EncA256GCM = "A256GCM" // AES GCM with 256-bit key.
 )
 
 // The default type string.
 const (
 	DefaultType = "JWT"
 )
+
+// ContentTypeJWT is the content type for nested tokens, where an encrypted
+// token contains a signed token.
+const ContentTypeJWT = "JWT"
@@ -0,0 +1,83 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Audience is the audience claim. In JSON, it is either a single string or
+// an array of strings.
+type Audience []string
+
+// MarshalJSON marshals the audience into a string if it has exactly one
+// audience, or an array of strings otherwise. An empty audience is
+// marshalled into an empty string.
+func (a Audience) MarshalJSON() ([]byte, error) {
+	switch len(a) {
+	case 0:
+		return json.Marshal("")
+	case 1:
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// UnmarshalJSON unmarshals the audience from either a string or an array of
+// strings.
+func (a *Audience) UnmarshalJSON(bs []byte) error {
+	bs = bytes.TrimSpace(bs)
+	if bytes.Equal(bs, []byte("null")) {
+		*a = nil
+		return nil
+	}
+
+	if len(bs) > 0 && bs[0] == '"' {
+		var s string
+		if err := json.Unmarshal(bs, &s); err != nil {
+			return err
+		}
+		if s == "" {
+			*a = nil
+		} else {
+			*a = Audience{s}
+		}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(bs, &list); err != nil {
+		return err
+	}
+	*a = Audience(list)
+	return nil
+}
+
+// Contains checks if s is one of the audiences.
+func (a Audience) Contains(s string) bool {
+	return hasString([]string(a), s)
+}
+
+// ContainsAny checks if any of the given strings is one of the audiences.
+func (a Audience) ContainsAny(list []string) bool {
+	for _, s := range list {
+		if a.Contains(s) {
+			return true
+		}
+	}
+	return false
+}
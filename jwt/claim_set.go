@@ -17,28 +17,44 @@ package jwt
 
 import (
 	"encoding/json"
+
+	"shanhu.io/misc/errcode"
+	"shanhu.io/misc/rand"
 )
 
 // ClaimSet contains the JWT claims
 type ClaimSet struct {
-	Iss   string `json:"iss"`   // Issuer.
-	Scope string `json:"scope"` // Scope, space-delimited list.
-	Aud   string `json:"aud"`   // Audiance. Intended target.
-	Exp   int64  `json:"exp"`   // Expiration time (Unix timestamp seconds)
-	Iat   int64  `json:"iat"`   // Asserstion time (Unix timestamp seconds)
-	Typ   string `json:"typ"`   // Token type.
+	Iss   string   `json:"iss"`   // Issuer.
+	Scope string   `json:"scope"` // Scope, space-delimited list.
+	Aud   Audience `json:"aud"`   // Audiance. Intended target(s).
+	Exp   int64    `json:"exp"`   // Expiration time (Unix timestamp seconds)
+	Iat   int64    `json:"iat"`   // Asserstion time (Unix timestamp seconds)
+	Nbf   int64    `json:"nbf"`   // Not before time (Unix timestamp seconds)
+	Typ   string   `json:"typ"`   // Token type.
 
 	Sub string `json:"sub"`
+	Jti string `json:"jti"` // Token ID, optional.
 
 	Extra map[string]interface{} `json:"-"`
 }
 
-// ExtraString reads an extra string field from the claim set.
-func (c *ClaimSet) ExtraString(k string) (string, bool) {
+// NewJTI generates a new random token ID. Tokens need a token ID to be
+// revocable.
+func NewJTI() string {
+	return rand.HexBytes(16)
+}
+
+func (c *ClaimSet) extra(k string) (interface{}, bool) {
 	if len(c.Extra) == 0 {
-		return "", false
+		return nil, false
 	}
 	v, ok := c.Extra[k]
+	return v, ok
+}
+
+// ExtraString reads an extra string field from the claim set.
+func (c *ClaimSet) ExtraString(k string) (string, bool) {
+	v, ok := c.extra(k)
 	if !ok {
 		return "", false
 	}
@@ -49,7 +65,96 @@ func (c *ClaimSet) ExtraString(k string) (string, bool) {
 	return s, true
 }
 
-func (c *ClaimSet) encode() (string, error) {
+// ExtraInt64 reads an extra integer field from the claim set.
+func (c *ClaimSet) ExtraInt64(k string) (int64, bool) {
+	v, ok := c.extra(k)
+	if !ok {
+		return 0, false
+	}
+	switch v := v.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case float64:
+		i := int64(v)
+		if float64(i) != v {
+			return 0, false
+		}
+		return i, true
+	case json.Number:
+		i, err := v.Int64()
+		if err != nil {
+			return 0, false
+		}
+		return i, true
+	}
+	return 0, false
+}
+
+// ExtraBool reads an extra boolean field from the claim set.
+func (c *ClaimSet) ExtraBool(k string) (bool, bool) {
+	v, ok := c.extra(k)
+	if !ok {
+		return false, false
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, false
+	}
+	return b, true
+}
+
+// ExtraStrings reads an extra field that is a list of strings from the
+// claim set.
+func (c *ClaimSet) ExtraStrings(k string) ([]string, bool) {
+	v, ok := c.extra(k)
+	if !ok {
+		return nil, false
+	}
+	switch v := v.(type) {
+	case []string:
+		return v, true
+	case []interface{}:
+		ret := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			ret = append(ret, s)
+		}
+		return ret, true
+	}
+	return nil, false
+}
+
+// UnmarshalExtra unmarshals an extra field from the claim set into v, using
+// JSON encoding. It returns a not-found error if the field does not exist.
+func (c *ClaimSet) UnmarshalExtra(k string, v interface{}) error {
+	extra, ok := c.extra(k)
+	if !ok {
+		return errcode.NotFoundf("claim %q not found", k)
+	}
+	bs, err := json.Marshal(extra)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bs, v)
+}
+
+// Unmarshal unmarshals all the claims, including the extra ones, into v,
+// using JSON encoding. v is often a caller-defined struct that has fields
+// for the custom claims.
+func (c *ClaimSet) Unmarshal(v interface{}) error {
+	bs, err := json.Marshal(c.claims())
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bs, v)
+}
+
+func (c *ClaimSet) claims() map[string]interface{} {
 	m := make(map[string]interface{})
 
 	for _, entry := range []struct {
@@ -58,23 +163,30 @@ func (c *ClaimSet) encode() (string, error) {
 	}{
 		{k: "iss", v: c.Iss, mustHave: true},
 		{k: "scope", v: c.Scope},
-		{k: "aud", v: c.Aud, mustHave: true},
 		{k: "typ", v: c.Typ},
 		{k: "sub", v: c.Sub},
+		{k: "jti", v: c.Jti},
 	} {
 		if entry.mustHave || entry.v != "" {
 			m[entry.k] = entry.v
 		}
 	}
 
+	m["aud"] = c.Aud
 	m["exp"] = c.Exp
 	m["iat"] = c.Iat
+	if c.Nbf != 0 {
+		m["nbf"] = c.Nbf
+	}
 
 	for k, v := range c.Extra {
 		m[k] = v
 	}
+	return m
+}
 
-	return encodeSegment(m)
+func (c *ClaimSet) encode() (string, error) {
+	return encodeSegment(c.claims())
 }
 
 func decodeClaimSet(s string) (*ClaimSet, error) {
@@ -82,7 +194,10 @@ func decodeClaimSet(s string) (*ClaimSet, error) {
 	if err != nil {
 		return nil, err
 	}
+	return decodeClaimSetJSON(bs)
+}
 
+func decodeClaimSetJSON(bs []byte) (*ClaimSet, error) {
 	c := new(ClaimSet)
 	if err := json.Unmarshal(bs, c); err != nil {
 		return nil, err
@@ -93,7 +208,7 @@ func decodeClaimSet(s string) (*ClaimSet, error) {
 	}
 
 	for _, k := range []string{
-		"iss", "scope", "aud", "exp", "iat", "typ", "sub",
+		"iss", "scope", "aud", "exp", "iat", "nbf", "typ", "sub", "jti",
 	} {
 		delete(m, k)
 	}
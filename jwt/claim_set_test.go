@@ -0,0 +1,94 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"testing"
+
+	"reflect"
+)
+
+func TestDecodeClaimSet(t *testing.T) {
+	payload := encodeSegmentBytes([]byte(`{
+		"iss": "https://accounts.example.com",
+		"aud": ["nextcloud", "homedrv"],
+		"exp": 1600003600,
+		"iat": 1600000000,
+		"email_verified": true,
+		"groups": ["admin", "dev"],
+		"level": 3,
+		"profile": {"name": "h8liu"}
+	}`))
+
+	c, err := decodeClaimSet(payload)
+	if err != nil {
+		t.Fatal("decode: ", err)
+	}
+
+	if want := (Audience{"nextcloud", "homedrv"}); !reflect.DeepEqual(
+		c.Aud, want,
+	) {
+		t.Errorf("got audience %q, want %q", c.Aud, want)
+	}
+	if !c.Aud.Contains("homedrv") {
+		t.Errorf("audience should contain homedrv")
+	}
+
+	if v, ok := c.ExtraBool("email_verified"); !ok || !v {
+		t.Errorf("got email_verified %t, %t", v, ok)
+	}
+	if v, ok := c.ExtraInt64("level"); !ok || v != 3 {
+		t.Errorf("got level %d, %t", v, ok)
+	}
+	groups, ok := c.ExtraStrings("groups")
+	if want := []string{"admin", "dev"}; !ok || !reflect.DeepEqual(
+		groups, want,
+	) {
+		t.Errorf("got groups %q, want %q", groups, want)
+	}
+
+	var profile struct {
+		Name string `json:"name"`
+	}
+	if err := c.UnmarshalExtra("profile", &profile); err != nil {
+		t.Fatal("unmarshal profile: ", err)
+	}
+	if profile.Name != "h8liu" {
+		t.Errorf("got profile name %q, want h8liu", profile.Name)
+	}
+
+	var claims struct {
+		Iss    string   `json:"iss"`
+		Aud    []string `json:"aud"`
+		Groups []string `json:"groups"`
+	}
+	if err := c.Unmarshal(&claims); err != nil {
+		t.Fatal("unmarshal claims: ", err)
+	}
+	if claims.Iss != c.Iss || len(claims.Aud) != 2 || len(claims.Groups) != 2 {
+		t.Errorf("got claims %+v", claims)
+	}
+
+	// Single audience is encoded as a string.
+	single := &ClaimSet{Aud: Audience{"nextcloud"}}
+	bs, err := single.Aud.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(bs); got != `"nextcloud"` {
+		t.Errorf("got encoded audience %s", got)
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"context"
+	"net/http"
+)
+
+type contextKey struct{}
+
+// NewContext returns a new context that carries the token.
+func NewContext(ctx context.Context, tok *Token) context.Context {
+	return context.WithValue(ctx, contextKey{}, tok)
+}
+
+// FromContext returns the token in the context, if any.
+func FromContext(ctx context.Context) (*Token, bool) {
+	tok, ok := ctx.Value(contextKey{}).(*Token)
+	return tok, ok
+}
+
+// FromRequest returns the token in the context of the request, if any.
+func FromRequest(req *http.Request) (*Token, bool) {
+	return FromContext(req.Context())
+}
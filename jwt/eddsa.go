@@ -0,0 +1,91 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"crypto/ed25519"
+
+	"shanhu.io/misc/errcode"
+)
+
+// EdDSA implements the EdDSA signing algorithm with Ed25519 keys.
+type EdDSA struct {
+	key    ed25519.PrivateKey
+	pub    ed25519.PublicKey
+	header *Header
+}
+
+func newEdDSA(
+	key ed25519.PrivateKey, pub ed25519.PublicKey, kid string,
+) *EdDSA {
+	return &EdDSA{
+		key:    key,
+		pub:    pub,
+		header: newHeader(AlgEdDSA, kid),
+	}
+}
+
+// NewEdDSA creates a new EdDSA signer using the given private key. The key
+// ID is the hash of the public key.
+func NewEdDSA(k ed25519.PrivateKey) (*EdDSA, error) {
+	if len(k) != ed25519.PrivateKeySize {
+		return nil, errcode.InvalidArgf("invalid ed25519 private key")
+	}
+	pub := k.Public().(ed25519.PublicKey)
+	kid, err := KeyID(pub)
+	if err != nil {
+		return nil, errcode.Annotate(err, "make key id")
+	}
+	return newEdDSA(k, pub, kid), nil
+}
+
+// NewEdDSAVerifier creates a new EdDSA verifier using the given public key.
+// The key ID is the hash of the public key.
+func NewEdDSAVerifier(k ed25519.PublicKey) (*EdDSA, error) {
+	if len(k) != ed25519.PublicKeySize {
+		return nil, errcode.InvalidArgf("invalid ed25519 public key")
+	}
+	kid, err := KeyID(k)
+	if err != nil {
+		return nil, errcode.Annotate(err, "make key id")
+	}
+	return newEdDSA(nil, k, kid), nil
+}
+
+// Header returns the JWT header for this signer.
+func (s *EdDSA) Header() (*Header, error) {
+	cp := *s.header
+	return &cp, nil
+}
+
+// Sign signs the EdDSA signature.
+func (s *EdDSA) Sign(_ *Header, data []byte) ([]byte, error) {
+	if s.key == nil {
+		return nil, errcode.InvalidArgf("no private key")
+	}
+	return ed25519.Sign(s.key, data), nil
+}
+
+// Verify verifies the EdDSA signature.
+func (s *EdDSA) Verify(header *Header, data, sig []byte) error {
+	if err := checkHeader(header, s.header); err != nil {
+		return err
+	}
+	if !ed25519.Verify(s.pub, data, sig) {
+		return errcode.InvalidArgf("wrong signature")
+	}
+	return nil
+}
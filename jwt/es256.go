@@ -0,0 +1,117 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"math/big"
+
+	"shanhu.io/misc/errcode"
+)
+
+const es256KeySize = 32
+
+// ES256 implements the ES256 signing algorithm. It uses SHA256 hash and
+// ECDSA signing on the P-256 curve.
+type ES256 struct {
+	key    *ecdsa.PrivateKey
+	pub    *ecdsa.PublicKey
+	header *Header
+}
+
+func checkP256(k *ecdsa.PublicKey) error {
+	if k.Curve != elliptic.P256() {
+		return errcode.InvalidArgf("key is not on curve P-256")
+	}
+	return nil
+}
+
+func newES256(key *ecdsa.PrivateKey, pub *ecdsa.PublicKey, kid string) *ES256 {
+	return &ES256{
+		key:    key,
+		pub:    pub,
+		header: newHeader(AlgES256, kid),
+	}
+}
+
+// NewES256 creates a new ES256 signer using the given private key. The key
+// ID is the hash of the public key.
+func NewES256(k *ecdsa.PrivateKey) (*ES256, error) {
+	if err := checkP256(&k.PublicKey); err != nil {
+		return nil, err
+	}
+	kid, err := KeyID(&k.PublicKey)
+	if err != nil {
+		return nil, errcode.Annotate(err, "make key id")
+	}
+	return newES256(k, &k.PublicKey, kid), nil
+}
+
+// NewES256Verifier creates a new ES256 verifier using the given public key.
+// The key ID is the hash of the public key.
+func NewES256Verifier(k *ecdsa.PublicKey) (*ES256, error) {
+	if err := checkP256(k); err != nil {
+		return nil, err
+	}
+	kid, err := KeyID(k)
+	if err != nil {
+		return nil, errcode.Annotate(err, "make key id")
+	}
+	return newES256(nil, k, kid), nil
+}
+
+// Header returns the JWT header for this signer.
+func (s *ES256) Header() (*Header, error) {
+	cp := *s.header
+	return &cp, nil
+}
+
+// Sign signs the ES256 signature. The signature is the concatenation of R
+// and S, each as a 32-byte big-endian integer.
+func (s *ES256) Sign(_ *Header, data []byte) ([]byte, error) {
+	if s.key == nil {
+		return nil, errcode.InvalidArgf("no private key")
+	}
+	hash := sha256.Sum256(data)
+	r, ss, err := ecdsa.Sign(rand.Reader, s.key, hash[:])
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 2*es256KeySize)
+	r.FillBytes(sig[:es256KeySize])
+	ss.FillBytes(sig[es256KeySize:])
+	return sig, nil
+}
+
+// Verify verifies the ES256 signature.
+func (s *ES256) Verify(header *Header, data, sig []byte) error {
+	if err := checkHeader(header, s.header); err != nil {
+		return err
+	}
+	if len(sig) != 2*es256KeySize {
+		return errcode.InvalidArgf("wrong signature length: %d", len(sig))
+	}
+	r := new(big.Int).SetBytes(sig[:es256KeySize])
+	ss := new(big.Int).SetBytes(sig[es256KeySize:])
+	hash := sha256.Sum256(data)
+	if !ecdsa.Verify(s.pub, hash[:], r, ss) {
+		return errcode.InvalidArgf("wrong signature")
+	}
+	return nil
+}
@@ -26,6 +26,9 @@ type Header struct {
 	Alg   string `json:"alg"`
 	Typ   string `json:"typ"`
 	KeyID string `json:"kid,omitempty"` // Key ID.
+
+	Enc string `json:"enc,omitempty"` // Content encryption, for JWE only.
+	Cty string `json:"cty,omitempty"` // Content type, for nested tokens.
 }
 
 func (h *Header) encode() (string, error) {
@@ -56,3 +59,16 @@ func checkHeader(got, want *Header) error {
 	}
 	return nil
 }
+
+func checkEncHeader(got, want *Header) error {
+	if got.KeyID != want.KeyID {
+		return errcode.InvalidArgf("kid=%q, want %q", got.KeyID, want.KeyID)
+	}
+	if got.Alg != want.Alg {
+		return errcode.InvalidArgf("alg=%q, want %q", got.Alg, want.Alg)
+	}
+	if got.Enc != want.Enc {
+		return errcode.InvalidArgf("enc=%q, want %q", got.Enc, want.Enc)
+	}
+	return nil
+}
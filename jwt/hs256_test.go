@@ -29,7 +29,7 @@ func TestHS256(t *testing.T) {
 	now := time.Now()
 	c := &ClaimSet{
 		Iss: "shanhu.io",
-		Aud: "nextcloud",
+		Aud: Audience{"nextcloud"},
 		Iat: now.Unix(),
 		Exp: now.Add(time.Hour).Unix(),
 		Sub: "h8liu",
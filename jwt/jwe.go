@@ -0,0 +1,188 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/json"
+	"strings"
+
+	"shanhu.io/misc/errcode"
+	"shanhu.io/misc/rand"
+)
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != a256gcmKeySize {
+		return nil, errcode.InvalidArgf(
+			"content key is %d bytes, want %d", len(key), a256gcmKeySize,
+		)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encrypt(h *Header, e Encrypter, plain []byte) (string, error) {
+	if h.Enc != EncA256GCM {
+		return "", errcode.InvalidArgf("unsupported enc %q", h.Enc)
+	}
+	hb, err := h.encode()
+	if err != nil {
+		return "", errcode.Annotate(err, "encode header")
+	}
+	cek, encryptedKey, err := e.EncryptKey(h)
+	if err != nil {
+		return "", errcode.Annotate(err, "encrypt key")
+	}
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return "", err
+	}
+
+	iv := rand.Bytes(gcm.NonceSize())
+	sealed := gcm.Seal(nil, iv, plain, []byte(hb))
+	n := len(sealed) - gcm.Overhead()
+	ciphertext, tag := sealed[:n], sealed[n:]
+
+	return strings.Join([]string{
+		hb,
+		encodeSegmentBytes(encryptedKey),
+		encodeSegmentBytes(iv),
+		encodeSegmentBytes(ciphertext),
+		encodeSegmentBytes(tag),
+	}, "."), nil
+}
+
+func decrypt(token string, d Decrypter) (*Header, []byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return nil, nil, errcode.InvalidArgf(
+			"invalid encrypted token: %d parts", len(parts),
+		)
+	}
+
+	header := new(Header)
+	if err := decodeSegment(parts[0], header); err != nil {
+		return nil, nil, errcode.InvalidArgf("decode header: %s", err)
+	}
+	if header.Enc != EncA256GCM {
+		return nil, nil, errcode.InvalidArgf(
+			"unsupported enc %q", header.Enc,
+		)
+	}
+
+	var segs [][]byte
+	for i, name := range []string{"key", "iv", "ciphertext", "tag"} {
+		bs, err := decodeSegmentBytes(parts[i+1])
+		if err != nil {
+			return nil, nil, errcode.InvalidArgf("decode %s: %s", name, err)
+		}
+		segs = append(segs, bs)
+	}
+	encryptedKey, iv, ciphertext, tag := segs[0], segs[1], segs[2], segs[3]
+
+	cek, err := d.DecryptKey(header, encryptedKey)
+	if err != nil {
+		return nil, nil, errcode.Annotate(err, "decrypt key")
+	}
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(iv) != gcm.NonceSize() || len(tag) != gcm.Overhead() {
+		return nil, nil, errcode.InvalidArgf("invalid iv or tag size")
+	}
+
+	sealed := append(ciphertext, tag...)
+	plain, err := gcm.Open(nil, iv, sealed, []byte(parts[0]))
+	if err != nil {
+		return nil, nil, errcode.InvalidArgf("decrypt failed")
+	}
+	return header, plain, nil
+}
+
+// EncodeAndEncrypt encodes a claim set and encrypts it into a JWE token in
+// compact serialization.
+func EncodeAndEncrypt(c *ClaimSet, e Encrypter) (string, error) {
+	h, err := e.Header()
+	if err != nil {
+		return "", errcode.Annotate(err, "get header")
+	}
+	claims, err := json.Marshal(c.claims())
+	if err != nil {
+		return "", errcode.Annotate(err, "encode claims")
+	}
+	return encrypt(h, e, claims)
+}
+
+// DecryptAndDecode decrypts and decodes a JWE token that directly contains
+// a claim set. Use DecryptAndVerify for nested tokens.
+func DecryptAndDecode(token string, d Decrypter) (*Token, error) {
+	h, plain, err := decrypt(token, d)
+	if err != nil {
+		return nil, err
+	}
+	if h.Cty == ContentTypeJWT {
+		return nil, errcode.InvalidArgf("token is nested, need verifying")
+	}
+	claims, err := decodeClaimSetJSON(plain)
+	if err != nil {
+		return nil, errcode.InvalidArgf("decode claims: %s", err)
+	}
+	return &Token{
+		Header:   h,
+		ClaimSet: claims,
+	}, nil
+}
+
+// EncodeSignAndEncrypt signs a claim set into a JWS token, and then
+// encrypts the signed token into a nested JWE token.
+func EncodeSignAndEncrypt(c *ClaimSet, s Signer, e Encrypter) (
+	string, error,
+) {
+	signed, err := EncodeAndSign(c, s)
+	if err != nil {
+		return "", err
+	}
+	h, err := e.Header()
+	if err != nil {
+		return "", errcode.Annotate(err, "get header")
+	}
+	h.Cty = ContentTypeJWT
+	return encrypt(h, e, []byte(signed))
+}
+
+// DecryptAndVerify decrypts a nested JWE token, and then decodes and
+// verifies the signed token inside. The returned token is the inner signed
+// token.
+func DecryptAndVerify(token string, d Decrypter, v Verifier) (
+	*Token, error,
+) {
+	h, plain, err := decrypt(token, d)
+	if err != nil {
+		return nil, err
+	}
+	if h.Cty != ContentTypeJWT {
+		return nil, errcode.InvalidArgf("token is not nested")
+	}
+	if v == nil {
+		return nil, errcode.InvalidArgf("verifier missing")
+	}
+	return DecodeAndVerify(string(plain), v)
+}
@@ -0,0 +1,165 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+
+	"shanhu.io/misc/errcode"
+	mrand "shanhu.io/misc/rand"
+)
+
+const a256gcmKeySize = 32
+
+// Encrypter provides the content encryption key for encrypting a token.
+type Encrypter interface {
+	Header() (*Header, error)
+
+	// EncryptKey returns the content encryption key, and the encrypted key
+	// to include in the token.
+	EncryptKey(h *Header) (cek, encryptedKey []byte, err error)
+}
+
+// Decrypter recovers the content encryption key for decrypting a token.
+type Decrypter interface {
+	DecryptKey(h *Header, encryptedKey []byte) ([]byte, error)
+}
+
+func newEncHeader(alg, kid string) *Header {
+	h := newHeader(alg, kid)
+	h.Enc = EncA256GCM
+	return h
+}
+
+// Dir implements the "dir" key management algorithm with A256GCM content
+// encryption. It uses a shared symmetric key directly as the content
+// encryption key.
+type Dir struct {
+	key    []byte
+	header *Header
+}
+
+// NewDir creates a new direct encrypter and decrypter using the given
+// 256-bit key and key ID.
+func NewDir(key []byte, kid string) (*Dir, error) {
+	if len(key) != a256gcmKeySize {
+		return nil, errcode.InvalidArgf(
+			"key is %d bytes, want %d", len(key), a256gcmKeySize,
+		)
+	}
+	return &Dir{
+		key:    key,
+		header: newEncHeader(AlgDir, kid),
+	}, nil
+}
+
+// Header returns the JWE header for this encrypter.
+func (d *Dir) Header() (*Header, error) {
+	cp := *d.header
+	return &cp, nil
+}
+
+// EncryptKey returns the shared key as the content encryption key.
+func (d *Dir) EncryptKey(_ *Header) ([]byte, []byte, error) {
+	return d.key, nil, nil
+}
+
+// DecryptKey returns the shared key as the content encryption key.
+func (d *Dir) DecryptKey(h *Header, encryptedKey []byte) ([]byte, error) {
+	if err := checkEncHeader(h, d.header); err != nil {
+		return nil, err
+	}
+	if len(encryptedKey) != 0 {
+		return nil, errcode.InvalidArgf("encrypted key must be empty")
+	}
+	return d.key, nil
+}
+
+// RSAOAEP256 implements the "RSA-OAEP-256" key management algorithm with
+// A256GCM content encryption. It encrypts a random content encryption key
+// with the RSA public key.
+type RSAOAEP256 struct {
+	key    *rsa.PrivateKey
+	pub    *rsa.PublicKey
+	header *Header
+}
+
+// NewRSAOAEP256 creates a new RSA-OAEP-256 encrypter and decrypter using the
+// given private key. The key ID is the hash of the public key.
+func NewRSAOAEP256(k *rsa.PrivateKey) (*RSAOAEP256, error) {
+	kid, err := KeyID(&k.PublicKey)
+	if err != nil {
+		return nil, errcode.Annotate(err, "make key id")
+	}
+	return &RSAOAEP256{
+		key:    k,
+		pub:    &k.PublicKey,
+		header: newEncHeader(AlgRSAOAEP256, kid),
+	}, nil
+}
+
+// NewRSAOAEP256Encrypter creates a new RSA-OAEP-256 encrypter using the
+// given public key. The key ID is the hash of the public key.
+func NewRSAOAEP256Encrypter(k *rsa.PublicKey) (*RSAOAEP256, error) {
+	kid, err := KeyID(k)
+	if err != nil {
+		return nil, errcode.Annotate(err, "make key id")
+	}
+	return &RSAOAEP256{
+		pub:    k,
+		header: newEncHeader(AlgRSAOAEP256, kid),
+	}, nil
+}
+
+// Header returns the JWE header for this encrypter.
+func (r *RSAOAEP256) Header() (*Header, error) {
+	cp := *r.header
+	return &cp, nil
+}
+
+// EncryptKey generates a random content encryption key and encrypts it
+// with the public key.
+func (r *RSAOAEP256) EncryptKey(_ *Header) ([]byte, []byte, error) {
+	cek := mrand.Bytes(a256gcmKeySize)
+	encrypted, err := rsa.EncryptOAEP(
+		sha256.New(), rand.Reader, r.pub, cek, nil,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cek, encrypted, nil
+}
+
+// DecryptKey decrypts the content encryption key with the private key.
+func (r *RSAOAEP256) DecryptKey(h *Header, encryptedKey []byte) (
+	[]byte, error,
+) {
+	if r.key == nil {
+		return nil, errcode.InvalidArgf("no private key")
+	}
+	if err := checkEncHeader(h, r.header); err != nil {
+		return nil, err
+	}
+	cek, err := rsa.DecryptOAEP(
+		sha256.New(), rand.Reader, r.key, encryptedKey, nil,
+	)
+	if err != nil {
+		return nil, errcode.InvalidArgf("decrypt key failed")
+	}
+	return cek, nil
+}
@@ -0,0 +1,116 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"testing"
+
+	"crypto/rand"
+	"crypto/rsa"
+	"time"
+
+	mrand "shanhu.io/misc/rand"
+)
+
+func testClaimSet() *ClaimSet {
+	now := time.Now()
+	return &ClaimSet{
+		Iss: "shanhu.io",
+		Aud: Audience{"nextcloud"},
+		Iat: now.Unix(),
+		Exp: now.Add(time.Hour).Unix(),
+		Sub: "h8liu",
+		Extra: map[string]interface{}{
+			"email": "h8liu@example.com",
+		},
+	}
+}
+
+func TestJWE(t *testing.T) {
+	dir, err := NewDir(mrand.Bytes(32), "dir1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oaep, err := NewRSAOAEP256(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oaepEnc, err := NewRSAOAEP256Encrypter(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := testClaimSet()
+	for _, test := range []struct {
+		name string
+		e    Encrypter
+		d    Decrypter
+	}{
+		{"dir", dir, dir},
+		{"rsa-oaep-256", oaepEnc, oaep},
+	} {
+		tokStr, err := EncodeAndEncrypt(c, test.e)
+		if err != nil {
+			t.Fatalf("%s: encrypt: %s", test.name, err)
+		}
+		tok, err := DecryptAndDecode(tokStr, test.d)
+		if err != nil {
+			t.Fatalf("%s: decrypt: %s", test.name, err)
+		}
+		email, _ := tok.ClaimSet.ExtraString("email")
+		if email != "h8liu@example.com" {
+			t.Errorf("%s: got email %q", test.name, email)
+		}
+
+		tampered := tokStr[:len(tokStr)-4] + "AAAA"
+		if _, err := DecryptAndDecode(tampered, test.d); err == nil {
+			t.Errorf("%s: tampered token decrypted", test.name)
+		}
+	}
+}
+
+func TestJWENested(t *testing.T) {
+	dir, err := NewDir(mrand.Bytes(32), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewHS256(mrand.Bytes(32), "")
+
+	c := testClaimSet()
+	tokStr, err := EncodeSignAndEncrypt(c, s, dir)
+	if err != nil {
+		t.Fatal("encrypt: ", err)
+	}
+	tok, err := DecryptAndVerify(tokStr, dir, s)
+	if err != nil {
+		t.Fatal("decrypt: ", err)
+	}
+	if got, want := tok.ClaimSet.Sub, c.Sub; got != want {
+		t.Errorf("got subject %q, want %q", got, want)
+	}
+
+	other := NewHS256(mrand.Bytes(32), "")
+	if _, err := DecryptAndVerify(tokStr, dir, other); err == nil {
+		t.Error("nested token verified with wrong key")
+	}
+	if _, err := DecryptAndDecode(tokStr, dir); err == nil {
+		t.Error("nested token decoded without verifying")
+	}
+}
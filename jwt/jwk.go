@@ -0,0 +1,213 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"math/big"
+
+	"shanhu.io/misc/errcode"
+)
+
+// Key types of JSON web keys.
+const (
+	KeyTypeRSA = "RSA"
+	KeyTypeEC  = "EC"
+	KeyTypeOKP = "OKP"
+)
+
+// JSONWebKey is a public key in JWK format, as defined in RFC 7517.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+
+	N string `json:"n,omitempty"` // RSA modulus.
+	E string `json:"e,omitempty"` // RSA exponent.
+
+	Crv string `json:"crv,omitempty"` // Curve of EC and OKP keys.
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet is a set of JSON web keys.
+type JSONWebKeySet struct {
+	Keys []*JSONWebKey `json:"keys"`
+}
+
+func encodeBigInt(i *big.Int, size int) string {
+	if size <= 0 {
+		return encodeSegmentBytes(i.Bytes())
+	}
+	bs := make([]byte, size)
+	i.FillBytes(bs)
+	return encodeSegmentBytes(bs)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	bs, err := decodeSegmentBytes(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(bs) == 0 {
+		return nil, errcode.InvalidArgf("empty integer")
+	}
+	return new(big.Int).SetBytes(bs), nil
+}
+
+// NewJSONWebKey creates a JSON web key for the given public key. When kid is
+// empty, the key ID is the hash of the public key.
+func NewJSONWebKey(pub crypto.PublicKey, kid string) (*JSONWebKey, error) {
+	if kid == "" {
+		id, err := KeyID(pub)
+		if err != nil {
+			return nil, errcode.Annotate(err, "make key id")
+		}
+		kid = id
+	}
+
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return &JSONWebKey{
+			Kty: KeyTypeRSA,
+			Kid: kid,
+			Alg: AlgRS256,
+			Use: "sig",
+			N:   encodeBigInt(k.N, 0),
+			E:   encodeBigInt(big.NewInt(int64(k.E)), 0),
+		}, nil
+	case *ecdsa.PublicKey:
+		if err := checkP256(k); err != nil {
+			return nil, err
+		}
+		return &JSONWebKey{
+			Kty: KeyTypeEC,
+			Kid: kid,
+			Alg: AlgES256,
+			Use: "sig",
+			Crv: "P-256",
+			X:   encodeBigInt(k.X, es256KeySize),
+			Y:   encodeBigInt(k.Y, es256KeySize),
+		}, nil
+	case ed25519.PublicKey:
+		return &JSONWebKey{
+			Kty: KeyTypeOKP,
+			Kid: kid,
+			Alg: AlgEdDSA,
+			Use: "sig",
+			Crv: "Ed25519",
+			X:   encodeSegmentBytes(k),
+		}, nil
+	}
+	return nil, errcode.InvalidArgf("unsupported public key type %T", pub)
+}
+
+// PublicKey returns the public key of the JSON web key.
+func (k *JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case KeyTypeRSA:
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, errcode.InvalidArgf("decode n: %s", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, errcode.InvalidArgf("decode e: %s", err)
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errcode.InvalidArgf("exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case KeyTypeEC:
+		if k.Crv != "P-256" {
+			return nil, errcode.InvalidArgf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, errcode.InvalidArgf("decode x: %s", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, errcode.InvalidArgf("decode y: %s", err)
+		}
+		curve := elliptic.P256()
+		if !curve.IsOnCurve(x, y) {
+			return nil, errcode.InvalidArgf("point not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case KeyTypeOKP:
+		if k.Crv != "Ed25519" {
+			return nil, errcode.InvalidArgf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeSegmentBytes(k.X)
+		if err != nil {
+			return nil, errcode.InvalidArgf("decode x: %s", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errcode.InvalidArgf("invalid ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, errcode.InvalidArgf("unsupported key type %q", k.Kty)
+}
+
+func (k *JSONWebKey) defaultAlg() string {
+	if k.Alg != "" {
+		return k.Alg
+	}
+	switch k.Kty {
+	case KeyTypeRSA:
+		return AlgRS256
+	case KeyTypeEC:
+		return AlgES256
+	case KeyTypeOKP:
+		return AlgEdDSA
+	}
+	return ""
+}
+
+// verifier creates a verifier for the key. The verifier expects tokens to
+// have the same key ID as the JSON web key.
+func (k *JSONWebKey) verifier() (Verifier, error) {
+	pub, err := k.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	alg := k.defaultAlg()
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if alg == AlgRS256 {
+			return newRS256(nil, pub, k.Kid), nil
+		}
+	case *ecdsa.PublicKey:
+		if alg == AlgES256 {
+			return newES256(nil, pub, k.Kid), nil
+		}
+	case ed25519.PublicKey:
+		if alg == AlgEdDSA {
+			return newEdDSA(nil, pub, k.Kid), nil
+		}
+	}
+	return nil, errcode.InvalidArgf(
+		"unsupported alg %q for key type %q", alg, k.Kty,
+	)
+}
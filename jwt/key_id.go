@@ -0,0 +1,37 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"crypto"
+
+	"shanhu.io/misc/rsautil"
+)
+
+// KeyID returns the key ID of a public key. The key ID is the SHA256 hash of
+// the public key in SSH authorized key format, encoded in URL-safe base64.
+// It is the same as rsautil.KeyHashString.
+func KeyID(k crypto.PublicKey) (string, error) {
+	return rsautil.KeyHashString(k)
+}
+
+func newHeader(alg, kid string) *Header {
+	return &Header{
+		Alg:   alg,
+		Typ:   DefaultType,
+		KeyID: kid,
+	}
+}
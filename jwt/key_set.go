@@ -0,0 +1,219 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"crypto"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"shanhu.io/misc/errcode"
+	"shanhu.io/misc/httputil"
+)
+
+type keySetEntry struct {
+	key      *JSONWebKey
+	verifier Verifier
+}
+
+// KeySet is a set of public keys. It verifies tokens by selecting the key
+// with the key ID and the algorithm in the token header. It is safe to use
+// concurrently, and can be refreshed when keys rotate.
+type KeySet struct {
+	mu      sync.RWMutex
+	keys    []*keySetEntry
+	entries map[string]map[string]*keySetEntry // kid -> alg -> entry
+}
+
+// NewKeySet creates a new empty key set.
+func NewKeySet() *KeySet {
+	return &KeySet{
+		entries: make(map[string]map[string]*keySetEntry),
+	}
+}
+
+func isSupportedKeyType(kty string) bool {
+	switch kty {
+	case KeyTypeRSA, KeyTypeEC, KeyTypeOKP:
+		return true
+	}
+	return false
+}
+
+func buildKeySetEntries(set *JSONWebKeySet) []*keySetEntry {
+	var entries []*keySetEntry
+	for _, k := range set.Keys {
+		// Skips keys that are not for signing, or that we do not support.
+		if k.Use == "enc" || !isSupportedKeyType(k.Kty) {
+			continue
+		}
+		v, err := k.verifier()
+		if err != nil {
+			// Unsupported algorithm or malformed key; other keys in the
+			// set are still usable.
+			continue
+		}
+		entries = append(entries, &keySetEntry{key: k, verifier: v})
+	}
+	return entries
+}
+
+// ParseKeySet parses a key set from a JWKS document. Keys that are not for
+// signing, have unsupported key types or algorithms, or are malformed are
+// ignored.
+func ParseKeySet(bs []byte) (*KeySet, error) {
+	s := NewKeySet()
+	if err := s.load(bs); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// FetchKeySet fetches and parses a JWKS document from the given path on the
+// server.
+func FetchKeySet(c *httputil.Client, p string) (*KeySet, error) {
+	s := NewKeySet()
+	if err := s.Refresh(c, p); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *KeySet) load(bs []byte) error {
+	set := new(JSONWebKeySet)
+	if err := json.Unmarshal(bs, set); err != nil {
+		return errcode.InvalidArgf("decode key set: %s", err)
+	}
+	s.replace(buildKeySetEntries(set))
+	return nil
+}
+
+func (s *KeySet) replace(entries []*keySetEntry) {
+	m := make(map[string]map[string]*keySetEntry)
+	for _, entry := range entries {
+		addEntry(m, entry)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = entries
+	s.entries = m
+}
+
+func addEntry(m map[string]map[string]*keySetEntry, entry *keySetEntry) {
+	kid := entry.key.Kid
+	algs, ok := m[kid]
+	if !ok {
+		algs = make(map[string]*keySetEntry)
+		m[kid] = algs
+	}
+	algs[entry.key.defaultAlg()] = entry
+}
+
+// Refresh fetches the JWKS document from the given path on the server, and
+// replaces all keys in the set with the keys in the document.
+func (s *KeySet) Refresh(c *httputil.Client, p string) error {
+	bs, err := c.GetBytes(p)
+	if err != nil {
+		return errcode.Annotate(err, "fetch key set")
+	}
+	return s.load(bs)
+}
+
+// Add adds a JSON web key into the key set. It replaces the existing key
+// that has the same key ID and algorithm.
+func (s *KeySet) Add(k *JSONWebKey) error {
+	v, err := k.verifier()
+	if err != nil {
+		return err
+	}
+	entry := &keySetEntry{key: k, verifier: v}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	alg := k.defaultAlg()
+	if algs, ok := s.entries[k.Kid]; ok {
+		if old, ok := algs[alg]; ok {
+			for i, e := range s.keys {
+				if e == old {
+					s.keys = append(s.keys[:i], s.keys[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+	s.keys = append(s.keys, entry)
+	addEntry(s.entries, entry)
+	return nil
+}
+
+// AddPublicKey adds a public key into the key set. The key ID is the hash of
+// the public key.
+func (s *KeySet) AddPublicKey(pub crypto.PublicKey) error {
+	k, err := NewJSONWebKey(pub, "")
+	if err != nil {
+		return err
+	}
+	return s.Add(k)
+}
+
+// Verify verifies the signature with the key selected by the key ID and
+// the algorithm in the header.
+func (s *KeySet) Verify(h *Header, data, sig []byte) error {
+	s.mu.RLock()
+	entry, ok := s.entries[h.KeyID][h.Alg]
+	s.mu.RUnlock()
+
+	if !ok {
+		return errcode.InvalidArgf("key %q not found for %q", h.KeyID, h.Alg)
+	}
+
+	// Tokens from identity providers may omit typ or use other types like
+	// "at+jwt", so keys are matched by kid and alg only.
+	hcp := *h
+	hcp.Typ = DefaultType
+	return entry.verifier.Verify(&hcp, data, sig)
+}
+
+// JSONWebKeySet returns the keys in the set as a JWKS document.
+func (s *KeySet) JSONWebKeySet() *JSONWebKeySet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]*JSONWebKey, 0, len(s.keys))
+	for _, entry := range s.keys {
+		keys = append(keys, entry.key)
+	}
+	return &JSONWebKeySet{Keys: keys}
+}
+
+// MarshalJSON marshals the key set into a JWKS document.
+func (s *KeySet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.JSONWebKeySet())
+}
+
+// ServeHTTP serves the key set as a JWKS document.
+func (s *KeySet) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	bs, err := s.MarshalJSON()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bs)
+}
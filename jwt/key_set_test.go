@@ -0,0 +1,202 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"testing"
+
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http/httptest"
+	"time"
+
+	"shanhu.io/misc/httputil"
+)
+
+func TestKeySet(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s1, err := NewES256(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := NewEdDSA(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverKeys := NewKeySet()
+	if err := serverKeys.AddPublicKey(&ecKey.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(serverKeys)
+	defer server.Close()
+
+	client, err := httputil.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := FetchKeySet(client, "/")
+	if err != nil {
+		t.Fatal("fetch key set: ", err)
+	}
+
+	now := time.Now()
+	c := &ClaimSet{
+		Iss: "shanhu.io",
+		Aud: Audience{"nextcloud"},
+		Iat: now.Unix(),
+		Exp: now.Add(time.Hour).Unix(),
+	}
+	tok1, err := EncodeAndSign(c, s1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok2, err := EncodeAndSign(c, s2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := DecodeAndVerify(tok1, keys); err != nil {
+		t.Errorf("verify with first key: %s", err)
+	}
+	if _, err := DecodeAndVerify(tok2, keys); err == nil {
+		t.Errorf("second key verified before rotation")
+	}
+
+	// Rotates in the second key.
+	if err := serverKeys.AddPublicKey(edKey.Public()); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.Refresh(client, "/"); err != nil {
+		t.Fatal("refresh key set: ", err)
+	}
+	for i, tok := range []string{tok1, tok2} {
+		if _, err := DecodeAndVerify(tok, keys); err != nil {
+			t.Errorf("verify with key %d: %s", i+1, err)
+		}
+	}
+}
+
+func TestParseKeySetSkipsUnsupported(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKID, err := KeyID(&ecKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecJWK, err := NewJSONWebKey(&ecKey.PublicKey, ecKID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaJWK, err := NewJSONWebKey(&rsaKey.PublicKey, "rsa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaJWK.Alg = "RS512"
+	bad := &JSONWebKey{Kty: KeyTypeEC, Kid: "bad", Crv: "P-256", X: "!"}
+
+	bs, err := json.Marshal(&JSONWebKeySet{
+		Keys: []*JSONWebKey{rsaJWK, bad, ecJWK},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := ParseKeySet(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewES256(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	tok, err := EncodeAndSign(&ClaimSet{
+		Iss: "shanhu.io",
+		Iat: now.Unix(),
+		Exp: now.Add(time.Hour).Unix(),
+	}, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeAndVerify(tok, keys); err != nil {
+		t.Errorf("verify with supported key: %s", err)
+	}
+}
+
+type typSigner struct {
+	Signer
+	typ string
+}
+
+func (s *typSigner) Header() (*Header, error) {
+	h, err := s.Signer.Header()
+	if err != nil {
+		return nil, err
+	}
+	cp := *h
+	cp.Typ = s.typ
+	return &cp, nil
+}
+
+func TestKeySetIgnoresType(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewES256(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := NewKeySet()
+	if err := keys.AddPublicKey(&ecKey.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	claims := &ClaimSet{
+		Iss: "shanhu.io",
+		Iat: now.Unix(),
+		Exp: now.Add(time.Hour).Unix(),
+	}
+	for _, typ := range []string{"", "at+jwt", "jwt"} {
+		tok, err := EncodeAndSign(claims, &typSigner{Signer: s, typ: typ})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := DecodeAndVerify(tok, keys); err != nil {
+			t.Errorf("verify token with typ %q: %s", typ, err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"shanhu.io/misc/errcode"
+	"shanhu.io/misc/httputil"
+)
+
+// Middleware authenticates HTTP requests with JWT bearer tokens. When the
+// token is valid, it saves the token in the request context, which can be
+// read with FromRequest.
+type Middleware struct {
+	// Verifier verifies the token signature.
+	Verifier Verifier
+
+	// Validator validates the token claims. When it is nil, the middleware
+	// only checks the time claims with DefaultLeeway.
+	Validator *Validator
+
+	// Optional lets requests without a bearer token pass through without
+	// a token in the context, unless scopes are required. Requests with an
+	// invalid token are still rejected.
+	Optional bool
+}
+
+var defaultValidator = &Validator{Leeway: DefaultLeeway}
+
+// Authenticate decodes, verifies and validates the bearer token of the
+// request.
+func (m *Middleware) Authenticate(req *http.Request) (*Token, error) {
+	tokStr, ok := httputil.BearerToken(req.Header)
+	if !ok {
+		return nil, errcode.Unauthorizedf("bearer token missing")
+	}
+	if m.Verifier == nil {
+		return nil, errcode.Internalf("verifier missing")
+	}
+	tok, err := DecodeAndVerify(tokStr, m.Verifier)
+	if err != nil {
+		if errcode.IsInternal(err) {
+			return nil, err
+		}
+		return nil, errcode.Add(errcode.Unauthorized, err)
+	}
+
+	v := m.Validator
+	if v == nil {
+		v = defaultValidator
+	}
+	if err := v.Validate(tok.ClaimSet); err != nil {
+		return nil, err
+	}
+	return tok, nil
+}
+
+// ErrorStatus returns the HTTP status code for an authentication error.
+// Only errors that are coded as authentication failures are unauthorized;
+// other errors, such as a failing revocation store, are internal errors.
+func ErrorStatus(err error) int {
+	switch errcode.Of(err) {
+	case CodeMissingScope:
+		return http.StatusForbidden
+	case errcode.Unauthorized, CodeExpired, CodeNotYetValid,
+		CodeWrongIssuer, CodeWrongAudience, CodeMissingClaim, CodeRevoked:
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
+
+func writeAuthError(w http.ResponseWriter, err error) {
+	status := ErrorStatus(err)
+	switch status {
+	case http.StatusUnauthorized:
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	case http.StatusForbidden:
+		w.Header().Set(
+			"WWW-Authenticate", `Bearer error="insufficient_scope"`,
+		)
+	default:
+		// Keeps the details of server failures out of the reply.
+		log.Println(err)
+		http.Error(w, "internal error", status)
+		return
+	}
+	http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(status), err), status)
+}
+
+// Wrap wraps a handler, so that it only serves requests with a valid bearer
+// token that has all the given scopes.
+func (m *Middleware) Wrap(h http.Handler, scopes ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if m.Optional && len(scopes) == 0 {
+			if _, ok := httputil.BearerToken(req.Header); !ok {
+				h.ServeHTTP(w, req)
+				return
+			}
+		}
+
+		tok, err := m.Authenticate(req)
+		if err == nil {
+			err = CheckScopes(tok.ClaimSet, scopes)
+		}
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+		h.ServeHTTP(w, req.WithContext(NewContext(req.Context(), tok)))
+	})
+}
@@ -0,0 +1,157 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"testing"
+
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"shanhu.io/misc/httputil"
+	"shanhu.io/misc/rand"
+)
+
+func TestMiddleware(t *testing.T) {
+	s := NewHS256(rand.Bytes(32), "")
+	m := &Middleware{
+		Verifier:  s,
+		Validator: &Validator{Audiences: []string{"nextcloud"}},
+	}
+
+	hello := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		tok, ok := FromRequest(req)
+		if !ok {
+			http.Error(w, "no token", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, tok.ClaimSet.Sub)
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/read", m.Wrap(hello, "read"))
+	mux.Handle("/write", m.Wrap(hello, "write"))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	newToken := func(aud string, exp time.Time) string {
+		c := &ClaimSet{
+			Iss:   "shanhu.io",
+			Aud:   Audience{aud},
+			Scope: "read",
+			Sub:   "h8liu",
+			Iat:   time.Now().Unix(),
+			Exp:   exp.Unix(),
+		}
+		tok, err := EncodeAndSign(c, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+
+	hour := time.Now().Add(time.Hour)
+	good := newToken("nextcloud", hour)
+	for _, test := range []struct {
+		p     string
+		token string
+		code  int
+	}{
+		{"/read", good, http.StatusOK},
+		{"/write", good, http.StatusForbidden},
+		{"/read", "", http.StatusUnauthorized},
+		{"/read", "bad.token.here", http.StatusUnauthorized},
+		{"/read", newToken("other", hour), http.StatusUnauthorized},
+		{
+			"/read",
+			newToken("nextcloud", time.Now().Add(-time.Hour)),
+			http.StatusUnauthorized,
+		},
+	} {
+		c, err := httputil.NewTokenClient(server.URL, test.token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, err := c.GetCode(test.p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != test.code {
+			t.Errorf("%s: got code %d, want %d", test.p, code, test.code)
+		}
+	}
+
+	c, err := httputil.NewTokenClient(server.URL, good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.GetString("/read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "h8liu" {
+		t.Errorf("got subject %q, want h8liu", got)
+	}
+}
+
+type brokenRevocationStore struct{}
+
+func (brokenRevocationStore) Revoke(jti string, exp time.Time) (bool, error) {
+	return false, fmt.Errorf("database down")
+}
+
+func (brokenRevocationStore) IsRevoked(jti string) (bool, error) {
+	return false, fmt.Errorf("database down")
+}
+
+func TestMiddlewareStoreFailure(t *testing.T) {
+	s := NewHS256(rand.Bytes(32), "")
+	m := &Middleware{
+		Verifier:  s,
+		Validator: &Validator{Revocations: brokenRevocationStore{}},
+	}
+	now := time.Now()
+	tok, err := EncodeAndSign(&ClaimSet{
+		Iss: "shanhu.io",
+		Jti: NewJTI(),
+		Iat: now.Unix(),
+		Exp: now.Add(time.Hour).Unix(),
+	}, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	httputil.SetAuthToken(req.Header, tok)
+	_, err = m.Authenticate(req)
+	if got := ErrorStatus(err); got != http.StatusInternalServerError {
+		t.Errorf("got status %d for store failure, want 500", got)
+	}
+
+	w := httptest.NewRecorder()
+	h := m.Wrap(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Error("handler called on store failure")
+	}))
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d for store failure, want 500", w.Code)
+	}
+	if body := w.Body.String(); strings.Contains(body, "database down") {
+		t.Errorf("store failure details leaked: %q", body)
+	}
+}
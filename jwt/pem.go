@@ -0,0 +1,108 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+
+	"shanhu.io/misc/errcode"
+	"shanhu.io/misc/rsautil"
+)
+
+// ParsePrivateKeyPEM parses a private key in PEM format. It supports PKCS#1
+// RSA keys, SEC 1 EC keys and PKCS#8 keys.
+func ParsePrivateKeyPEM(bs []byte) (crypto.PrivateKey, error) {
+	b, _ := pem.Decode(bs)
+	if b == nil {
+		return nil, errcode.InvalidArgf("pem decode failed")
+	}
+	switch b.Type {
+	case "RSA PRIVATE KEY":
+		return rsautil.ParsePrivateKey(bs)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(b.Bytes)
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(b.Bytes)
+	}
+	return nil, errcode.InvalidArgf("unsupported pem type %q", b.Type)
+}
+
+// ParsePublicKeyPEM parses a public key in PEM format. It supports PKIX
+// public keys and PKCS#1 RSA public keys.
+func ParsePublicKeyPEM(bs []byte) (crypto.PublicKey, error) {
+	b, _ := pem.Decode(bs)
+	if b == nil {
+		return nil, errcode.InvalidArgf("pem decode failed")
+	}
+	switch b.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(b.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(b.Bytes)
+	}
+	return nil, errcode.InvalidArgf("unsupported pem type %q", b.Type)
+}
+
+// NewSigner creates a signer for the given private key. The signing
+// algorithm is selected by the key type.
+func NewSigner(k crypto.PrivateKey) (Signer, error) {
+	switch k := k.(type) {
+	case *rsa.PrivateKey:
+		return NewRS256(k)
+	case *ecdsa.PrivateKey:
+		return NewES256(k)
+	case ed25519.PrivateKey:
+		return NewEdDSA(k)
+	}
+	return nil, errcode.InvalidArgf("unsupported private key type %T", k)
+}
+
+// NewVerifier creates a verifier for the given public key. The signing
+// algorithm is selected by the key type.
+func NewVerifier(k crypto.PublicKey) (Verifier, error) {
+	switch k := k.(type) {
+	case *rsa.PublicKey:
+		return NewRS256Verifier(k)
+	case *ecdsa.PublicKey:
+		return NewES256Verifier(k)
+	case ed25519.PublicKey:
+		return NewEdDSAVerifier(k)
+	}
+	return nil, errcode.InvalidArgf("unsupported public key type %T", k)
+}
+
+// NewSignerPEM creates a signer from a private key in PEM format.
+func NewSignerPEM(bs []byte) (Signer, error) {
+	k, err := ParsePrivateKeyPEM(bs)
+	if err != nil {
+		return nil, errcode.Annotate(err, "parse private key")
+	}
+	return NewSigner(k)
+}
+
+// NewVerifierPEM creates a verifier from a public key in PEM format.
+func NewVerifierPEM(bs []byte) (Verifier, error) {
+	k, err := ParsePublicKeyPEM(bs)
+	if err != nil {
+		return nil, errcode.Annotate(err, "parse public key")
+	}
+	return NewVerifier(k)
+}
@@ -0,0 +1,122 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"testing"
+
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+)
+
+func testKeyPEMs(t *testing.T, k crypto.PrivateKey, pub crypto.PublicKey) (
+	priBytes, pubBytes []byte,
+) {
+	t.Helper()
+
+	pri, err := x509.MarshalPKCS8PrivateKey(k)
+	if err != nil {
+		t.Fatal("marshal private key: ", err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal("marshal public key: ", err)
+	}
+	priBytes = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pri})
+	pubBytes = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+	return priBytes, pubBytes
+}
+
+func TestPublicKeySigners(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	c := &ClaimSet{
+		Iss: "shanhu.io",
+		Aud: Audience{"nextcloud"},
+		Iat: now.Unix(),
+		Exp: now.Add(time.Hour).Unix(),
+		Sub: "h8liu",
+	}
+
+	for _, test := range []struct {
+		alg string
+		key crypto.PrivateKey
+		pub crypto.PublicKey
+	}{
+		{AlgRS256, rsaKey, &rsaKey.PublicKey},
+		{AlgES256, ecKey, &ecKey.PublicKey},
+		{AlgEdDSA, edKey, edPub},
+	} {
+		priPEM, pubPEM := testKeyPEMs(t, test.key, test.pub)
+		s, err := NewSignerPEM(priPEM)
+		if err != nil {
+			t.Fatalf("%s: create signer: %s", test.alg, err)
+		}
+		v, err := NewVerifierPEM(pubPEM)
+		if err != nil {
+			t.Fatalf("%s: create verifier: %s", test.alg, err)
+		}
+
+		tokStr, err := EncodeAndSign(c, s)
+		if err != nil {
+			t.Fatalf("%s: encode: %s", test.alg, err)
+		}
+		tok, err := DecodeAndVerify(tokStr, v)
+		if err != nil {
+			t.Fatalf("%s: decode: %s", test.alg, err)
+		}
+		if tok.Header.Alg != test.alg {
+			t.Errorf("got alg %q, want %q", tok.Header.Alg, test.alg)
+		}
+		kid, err := KeyID(test.pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok.Header.KeyID != kid {
+			t.Errorf(
+				"%s: got key id %q, want %q",
+				test.alg, tok.Header.KeyID, kid,
+			)
+		}
+		if got, want := tok.ClaimSet.Sub, c.Sub; got != want {
+			t.Errorf("%s: got subject %q, want %q", test.alg, got, want)
+		}
+
+		tampered := tokStr[:len(tokStr)-4] + "AAAA"
+		if _, err := DecodeAndVerify(tampered, v); err == nil {
+			t.Errorf("%s: tampered token verified", test.alg)
+		}
+	}
+}
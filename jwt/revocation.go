@@ -0,0 +1,110 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"sync"
+	"time"
+
+	"shanhu.io/misc/errcode"
+)
+
+// RevocationStore saves the IDs of revoked tokens. A token only needs to be
+// kept in the store until it expires.
+type RevocationStore interface {
+	// Revoke revokes the token with the given ID, which expires at exp. It
+	// returns false if the token is already revoked.
+	Revoke(jti string, exp time.Time) (bool, error)
+
+	// IsRevoked checks if the token with the given ID is revoked.
+	IsRevoked(jti string) (bool, error)
+}
+
+// Revoke revokes a token by saving its ID into the store.
+func Revoke(s RevocationStore, c *ClaimSet) error {
+	if c.Jti == "" {
+		return errcode.InvalidArgf("token has no jti")
+	}
+	_, err := s.Revoke(c.Jti, time.Unix(c.Exp, 0))
+	return err
+}
+
+// MemRevocationStore is a revocation store in memory. Expired entries are
+// purged as new entries are added.
+type MemRevocationStore struct {
+	// TimeFunc is an optional function for reading the current timestamp.
+	// When it is nil, the store uses time.Now().
+	TimeFunc func() time.Time
+
+	mu      sync.Mutex
+	revoked map[string]time.Time
+	purged  time.Time
+}
+
+// NewMemRevocationStore creates a new revocation store in memory.
+func NewMemRevocationStore() *MemRevocationStore {
+	return &MemRevocationStore{
+		revoked: make(map[string]time.Time),
+	}
+}
+
+func (s *MemRevocationStore) now() time.Time {
+	if s.TimeFunc == nil {
+		return time.Now()
+	}
+	return s.TimeFunc()
+}
+
+const memRevocationPurgeInterval = time.Minute
+
+func (s *MemRevocationStore) purge(now time.Time) {
+	if now.Sub(s.purged) < memRevocationPurgeInterval {
+		return
+	}
+	for jti, exp := range s.revoked {
+		if now.After(exp) {
+			delete(s.revoked, jti)
+		}
+	}
+	s.purged = now
+}
+
+// Revoke revokes the token with the given ID.
+func (s *MemRevocationStore) Revoke(jti string, exp time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.purge(now)
+
+	if old, ok := s.revoked[jti]; ok && !now.After(old) {
+		return false, nil
+	}
+	s.revoked[jti] = exp
+	return true, nil
+}
+
+// IsRevoked checks if the token with the given ID is revoked.
+func (s *MemRevocationStore) IsRevoked(jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exp, ok := s.revoked[jti]
+	if !ok {
+		return false, nil
+	}
+	return !s.now().After(exp), nil
+}
@@ -0,0 +1,80 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"testing"
+
+	"time"
+
+	"shanhu.io/misc/errcode/errcodetest"
+	"shanhu.io/misc/rand"
+)
+
+func TestRevocation(t *testing.T) {
+	s := NewHS256(rand.Bytes(32), "")
+	now := time.Now()
+	c := &ClaimSet{
+		Iss: "shanhu.io",
+		Aud: Audience{"nextcloud"},
+		Iat: now.Unix(),
+		Exp: now.Add(time.Hour).Unix(),
+		Jti: NewJTI(),
+	}
+	tokStr, err := EncodeAndSign(c, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := DecodeAndVerify(tokStr, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.ClaimSet.Jti != c.Jti {
+		t.Errorf("got jti %q, want %q", tok.ClaimSet.Jti, c.Jti)
+	}
+	if _, ok := tok.ClaimSet.ExtraString("jti"); ok {
+		t.Errorf("jti should not be in extra claims")
+	}
+
+	store := NewMemRevocationStore()
+	v := &Validator{Revocations: store}
+	if err := v.Validate(tok.ClaimSet); err != nil {
+		t.Fatal(err)
+	}
+	if err := Revoke(store, tok.ClaimSet); err != nil {
+		t.Fatal(err)
+	}
+	errcodetest.CheckError(
+		t, v.Validate(tok.ClaimSet), CodeRevoked, "revoked token",
+	)
+
+	noID := *tok.ClaimSet
+	noID.Jti = ""
+	errcodetest.CheckError(
+		t, v.Validate(&noID), CodeMissingClaim, "token without jti",
+	)
+
+	once := &Validator{
+		Revocations: NewMemRevocationStore(),
+		OneTimeUse:  true,
+	}
+	if err := once.Validate(tok.ClaimSet); err != nil {
+		t.Fatal("first use: ", err)
+	}
+	errcodetest.CheckError(
+		t, once.Validate(tok.ClaimSet), CodeRevoked, "second use",
+	)
+}
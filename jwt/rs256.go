@@ -0,0 +1,89 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+
+	"shanhu.io/misc/errcode"
+)
+
+// RS256 implements the RS256 signing algorithm. It uses SHA256 hash and RSA
+// PKCS#1 v1.5 signing.
+type RS256 struct {
+	key    *rsa.PrivateKey
+	pub    *rsa.PublicKey
+	header *Header
+}
+
+func newRS256(key *rsa.PrivateKey, pub *rsa.PublicKey, kid string) *RS256 {
+	return &RS256{
+		key:    key,
+		pub:    pub,
+		header: newHeader(AlgRS256, kid),
+	}
+}
+
+// NewRS256 creates a new RS256 signer using the given private key. The key
+// ID is the hash of the public key.
+func NewRS256(k *rsa.PrivateKey) (*RS256, error) {
+	kid, err := KeyID(&k.PublicKey)
+	if err != nil {
+		return nil, errcode.Annotate(err, "make key id")
+	}
+	return newRS256(k, &k.PublicKey, kid), nil
+}
+
+// NewRS256Verifier creates a new RS256 verifier using the given public key.
+// The key ID is the hash of the public key.
+func NewRS256Verifier(k *rsa.PublicKey) (*RS256, error) {
+	kid, err := KeyID(k)
+	if err != nil {
+		return nil, errcode.Annotate(err, "make key id")
+	}
+	return newRS256(nil, k, kid), nil
+}
+
+// Header returns the JWT header for this signer.
+func (s *RS256) Header() (*Header, error) {
+	cp := *s.header
+	return &cp, nil
+}
+
+// Sign signs the RS256 signature.
+func (s *RS256) Sign(_ *Header, data []byte) ([]byte, error) {
+	if s.key == nil {
+		return nil, errcode.InvalidArgf("no private key")
+	}
+	hash := sha256.Sum256(data)
+	return rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, hash[:])
+}
+
+// Verify verifies the RS256 signature.
+func (s *RS256) Verify(header *Header, data, sig []byte) error {
+	if err := checkHeader(header, s.header); err != nil {
+		return err
+	}
+	hash := sha256.Sum256(data)
+	err := rsa.VerifyPKCS1v15(s.pub, crypto.SHA256, hash[:], sig)
+	if err != nil {
+		return errcode.InvalidArgf("wrong signature")
+	}
+	return nil
+}
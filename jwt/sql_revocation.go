@@ -0,0 +1,78 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"fmt"
+	"time"
+
+	"shanhu.io/misc/sqlx"
+)
+
+// SQLRevocationStore is a revocation store saved in a SQL table.
+type SQLRevocationStore struct {
+	db    *sqlx.DB
+	table string
+}
+
+// NewSQLRevocationStore creates a revocation store that uses the given
+// table in the database.
+func NewSQLRevocationStore(db *sqlx.DB, table string) *SQLRevocationStore {
+	return &SQLRevocationStore{db: db, table: table}
+}
+
+// CreateTable creates the table if it does not exist.
+func (s *SQLRevocationStore) CreateTable() error {
+	q := fmt.Sprintf(
+		"create table if not exists %s ("+
+			"jti text primary key, exp bigint not null)",
+		s.table,
+	)
+	_, err := s.db.X(q)
+	return err
+}
+
+// Revoke revokes the token with the given ID.
+func (s *SQLRevocationStore) Revoke(jti string, exp time.Time) (bool, error) {
+	q := fmt.Sprintf(
+		"insert into %s (jti, exp) values ($1, $2) "+
+			"on conflict (jti) do nothing",
+		s.table,
+	)
+	res, err := s.db.X(q, jti, exp.Unix())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, sqlx.Error(q, err)
+	}
+	return n > 0, nil
+}
+
+// IsRevoked checks if the token with the given ID is revoked.
+func (s *SQLRevocationStore) IsRevoked(jti string) (bool, error) {
+	q := fmt.Sprintf("select exp from %s where jti=$1", s.table)
+	var exp int64
+	return s.db.Q1(q, jti).Scan(&exp)
+}
+
+// Purge removes the tokens that expired before t.
+func (s *SQLRevocationStore) Purge(t time.Time) error {
+	q := fmt.Sprintf("delete from %s where exp<$1", s.table)
+	_, err := s.db.X(q, t.Unix())
+	return err
+}
@@ -0,0 +1,81 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"testing"
+
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"shanhu.io/misc/sqlx"
+)
+
+func TestSQLRevocationStore(t *testing.T) {
+	db, err := sqlx.OpenSqlite3(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	s := NewSQLRevocationStore(db, "revoked")
+	if err := s.CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateTable(); err != nil {
+		t.Fatalf("create table again: %s", err)
+	}
+
+	now := time.Unix(1600000000, 0)
+	for _, test := range []struct {
+		jti  string
+		exp  time.Time
+		want bool
+	}{
+		{"a", now.Add(-time.Hour), true},
+		{"b", now.Add(time.Hour), true},
+		{"b", now.Add(time.Hour), false},
+	} {
+		got, err := s.Revoke(test.jti, test.exp)
+		if err != nil {
+			t.Fatalf("revoke %q: %s", test.jti, err)
+		}
+		if got != test.want {
+			t.Errorf("revoke %q, got %t, want %t", test.jti, got, test.want)
+		}
+	}
+
+	check := func(jti string, want bool) {
+		t.Helper()
+		got, err := s.IsRevoked(jti)
+		if err != nil {
+			t.Fatalf("check %q: %s", jti, err)
+		}
+		if got != want {
+			t.Errorf("%q revoked is %t, want %t", jti, got, want)
+		}
+	}
+	check("a", true)
+	check("b", true)
+	check("c", false)
+
+	if err := s.Purge(now); err != nil {
+		t.Fatal(err)
+	}
+	check("a", false)
+	check("b", true)
+}
@@ -22,10 +22,11 @@ import (
 )
 
 // CheckTime checks if the token's claims is in valid at time now.
+// Use Validator for configurable checks.
 func CheckTime(claims *ClaimSet, now time.Time) (time.Duration, error) {
 	// Issued time must be after now.
 	// In case of small clock error, gives a 5 minute grace period.
-	issued := time.Unix(claims.Iat, 0).Add(-5 * time.Minute)
+	issued := time.Unix(claims.Iat, 0).Add(-DefaultLeeway)
 	if !issued.Before(now) {
 		return 0, errcode.Unauthorizedf("token issued in the future")
 	}
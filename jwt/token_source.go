@@ -0,0 +1,235 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"shanhu.io/misc/errcode"
+	"shanhu.io/misc/httputil"
+)
+
+// GrantTypeJWTBearer is the grant type for exchanging a JWT assertion for an
+// access token, as defined in RFC 7523.
+const GrantTypeJWTBearer = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+// DefaultRefreshBefore is the default time before expiry when a
+// TokenSource refreshes its cached token.
+const DefaultRefreshBefore = time.Minute
+
+// DefaultExchangeTimeout is the default time limit of exchanging a token
+// at the token endpoint.
+const DefaultExchangeTimeout = 30 * time.Second
+
+type tokenCall struct {
+	done    chan struct{}
+	token   string
+	expires time.Time
+	err     error
+}
+
+// TokenSource mints signed tokens on demand. It caches the token until
+// shortly before it expires. When there are concurrent callers, only one
+// token is minted at a time. It implements httputil.TokenSource.
+//
+// Optionally, it can exchange the signed token as an assertion for an
+// access token at a token endpoint, and caches the access token instead.
+type TokenSource struct {
+	signer Signer
+	claims *ClaimSet
+	ttl    time.Duration
+
+	// RefreshBefore is the time before expiry when the cached token
+	// is refreshed. When it is zero, DefaultRefreshBefore is used. It is
+	// capped at half of the token's lifetime, so that short-lived tokens
+	// are still cached.
+	RefreshBefore time.Duration
+
+	// Exchange is the optional client for exchanging the signed token for
+	// an access token, using the JWT bearer grant.
+	Exchange *httputil.Client
+
+	// ExchangePath is the path of the token endpoint on Exchange.
+	ExchangePath string
+
+	// ExchangeTimeout is the time limit of an exchange. When it is zero,
+	// DefaultExchangeTimeout is used.
+	ExchangeTimeout time.Duration
+
+	// TimeFunc is an optional function for reading the current timestamp.
+	// When it is nil, the token source uses time.Now().
+	TimeFunc func() time.Time
+
+	mu       sync.Mutex
+	token    string
+	expires  time.Time
+	lifetime time.Duration
+	call     *tokenCall
+}
+
+// NewTokenSource creates a token source that signs tokens using the claims
+// template. Each token is issued at the time of minting, and expires after
+// ttl. When the template has no token ID, each token gets a new random one.
+func NewTokenSource(
+	s Signer, claims *ClaimSet, ttl time.Duration,
+) *TokenSource {
+	return &TokenSource{
+		signer: s,
+		claims: claims,
+		ttl:    ttl,
+	}
+}
+
+func (s *TokenSource) now() time.Time {
+	if s.TimeFunc == nil {
+		return time.Now()
+	}
+	return s.TimeFunc()
+}
+
+func (s *TokenSource) refreshBefore(lifetime time.Duration) time.Duration {
+	d := s.RefreshBefore
+	if d == 0 {
+		d = DefaultRefreshBefore
+	}
+	if max := lifetime / 2; d > max {
+		return max
+	}
+	return d
+}
+
+func (s *TokenSource) exchangeTimeout() time.Duration {
+	if s.ExchangeTimeout == 0 {
+		return DefaultExchangeTimeout
+	}
+	return s.ExchangeTimeout
+}
+
+// Token returns a valid token, minting a new one if the cached one is
+// missing or about to expire.
+func (s *TokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	if s.token != "" {
+		refreshAt := s.expires.Add(-s.refreshBefore(s.lifetime))
+		if s.now().Before(refreshAt) {
+			tok := s.token
+			s.mu.Unlock()
+			return tok, nil
+		}
+	}
+
+	call := s.call
+	if call == nil {
+		call = &tokenCall{done: make(chan struct{})}
+		s.call = call
+		go s.refresh(call)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.token, call.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Refresh drops the cached token and mints a new one. It implements
+// httputil.Refresher, so that a client retries a request that is rejected
+// with HTTP 401 with a new token.
+func (s *TokenSource) Refresh(ctx context.Context) error {
+	s.mu.Lock()
+	s.token = ""
+	s.mu.Unlock()
+
+	_, err := s.Token(ctx)
+	return err
+}
+
+func (s *TokenSource) refresh(call *tokenCall) {
+	start := s.now()
+	call.token, call.expires, call.err = s.mint()
+
+	s.mu.Lock()
+	if call.err == nil {
+		s.token = call.token
+		s.expires = call.expires
+		s.lifetime = call.expires.Sub(start)
+	}
+	s.call = nil
+	s.mu.Unlock()
+
+	close(call.done)
+}
+
+func (s *TokenSource) mint() (string, time.Time, error) {
+	now := s.now()
+	c := *s.claims
+	c.Iat = now.Unix()
+	c.Exp = now.Add(s.ttl).Unix()
+	if c.Jti == "" {
+		c.Jti = NewJTI()
+	}
+
+	tok, err := EncodeAndSign(&c, s.signer)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expires := time.Unix(c.Exp, 0)
+
+	if s.Exchange == nil {
+		return tok, expires, nil
+	}
+	return s.exchange(tok, expires)
+}
+
+type exchangeResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func (s *TokenSource) exchange(assertion string, expires time.Time) (
+	string, time.Time, error,
+) {
+	form := make(url.Values)
+	form.Set("grant_type", GrantTypeJWTBearer)
+	form.Set("assertion", assertion)
+	if s.claims.Scope != "" {
+		form.Set("scope", s.claims.Scope)
+	}
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(), s.exchangeTimeout(),
+	)
+	defer cancel()
+
+	resp := new(exchangeResponse)
+	err := s.Exchange.FormCallContext(ctx, s.ExchangePath, form, resp)
+	if err != nil {
+		return "", time.Time{}, errcode.Annotate(err, "exchange token")
+	}
+	if resp.AccessToken == "" {
+		return "", time.Time{}, errcode.Internalf("no access token returned")
+	}
+	if resp.ExpiresIn > 0 {
+		expires = s.now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	}
+	return resp.AccessToken, expires, nil
+}
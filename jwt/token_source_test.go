@@ -0,0 +1,245 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"testing"
+
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"shanhu.io/misc/httputil"
+	"shanhu.io/misc/rand"
+)
+
+type countingSigner struct {
+	Signer
+	n int64
+}
+
+func (s *countingSigner) Sign(h *Header, data []byte) ([]byte, error) {
+	atomic.AddInt64(&s.n, 1)
+	time.Sleep(10 * time.Millisecond) // Gives other callers time to pile up.
+	return s.Signer.Sign(h, data)
+}
+
+func TestTokenSource(t *testing.T) {
+	hs := NewHS256(rand.Bytes(32), "")
+	signer := &countingSigner{Signer: hs}
+
+	now := time.Unix(1600000000, 0)
+	var clockMu sync.Mutex
+	clock := func() time.Time {
+		clockMu.Lock()
+		defer clockMu.Unlock()
+		return now
+	}
+	setClock := func(t time.Time) {
+		clockMu.Lock()
+		defer clockMu.Unlock()
+		now = t
+	}
+
+	claims := &ClaimSet{Iss: "shanhu.io", Aud: Audience{"nextcloud"}}
+	s := NewTokenSource(signer, claims, time.Hour)
+	s.TimeFunc = clock
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	tokens := make([]string, 10)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tok, err := s.Token(ctx)
+			if err != nil {
+				t.Error(err)
+			}
+			tokens[i] = tok
+		}(i)
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt64(&signer.n); n != 1 {
+		t.Errorf("signed %d times, want 1", n)
+	}
+	for _, tok := range tokens {
+		if tok != tokens[0] {
+			t.Fatalf("got different tokens %q and %q", tok, tokens[0])
+		}
+	}
+	tok, err := DecodeAndVerify(tokens[0], hs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tok.ClaimSet.Exp, now.Add(time.Hour).Unix(); got != want {
+		t.Errorf("got exp %d, want %d", got, want)
+	}
+
+	setClock(now.Add(30 * time.Minute))
+	if _, err := s.Token(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&signer.n); n != 1 {
+		t.Errorf("signed %d times, want cached", n)
+	}
+
+	setClock(now.Add(59*time.Minute + time.Second))
+	if _, err := s.Token(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&signer.n); n != 2 {
+		t.Errorf("signed %d times, want refreshed", n)
+	}
+}
+
+func TestTokenSourceExchange(t *testing.T) {
+	hs := NewHS256(rand.Bytes(32), "")
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			atomic.AddInt64(&calls, 1)
+			if got := req.FormValue("grant_type"); got != GrantTypeJWTBearer {
+				http.Error(w, "bad grant type", http.StatusBadRequest)
+				return
+			}
+			if _, err := DecodeAndVerify(
+				req.FormValue("assertion"), hs,
+			); err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(&exchangeResponse{
+				AccessToken: "access-token",
+				TokenType:   "Bearer",
+				ExpiresIn:   3600,
+			})
+		},
+	))
+	defer server.Close()
+
+	client, err := httputil.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := &ClaimSet{Iss: "shanhu.io", Aud: Audience{server.URL}}
+	s := NewTokenSource(hs, claims, time.Minute)
+	s.Exchange = client
+	s.ExchangePath = "/token"
+
+	for i := 0; i < 3; i++ {
+		tok, err := s.Token(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok != "access-token" {
+			t.Errorf("got token %q, want access-token", tok)
+		}
+	}
+	if n := atomic.LoadInt64(&calls); n != 1 {
+		t.Errorf("token endpoint called %d times, want 1", n)
+	}
+}
+
+func TestTokenSourceRefresh(t *testing.T) {
+	claims := &ClaimSet{Iss: "shanhu.io"}
+	var s httputil.Refresher = NewTokenSource(
+		NewHS256(rand.Bytes(32), ""), claims, time.Hour,
+	)
+	ts := s.(*TokenSource)
+
+	ctx := context.Background()
+	tok1, err := ts.Token(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	tok2, err := ts.Token(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok1 == tok2 {
+		t.Error("token not changed after refresh")
+	}
+}
+
+func TestTokenSourceShortTTL(t *testing.T) {
+	claims := &ClaimSet{Iss: "shanhu.io"}
+	s := NewTokenSource(NewHS256(rand.Bytes(32), ""), claims, time.Minute)
+
+	ctx := context.Background()
+	tok1, err := s.Token(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok2, err := s.Token(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok1 != tok2 {
+		t.Error("token with ttl of RefreshBefore is not cached")
+	}
+}
+
+func TestTokenSourceExchangeTimeout(t *testing.T) {
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			select {
+			case <-block:
+			case <-req.Context().Done():
+				return
+			}
+			json.NewEncoder(w).Encode(&exchangeResponse{
+				AccessToken: "access-token",
+				ExpiresIn:   3600,
+			})
+		},
+	))
+	defer server.Close()
+
+	client, err := httputil.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := &ClaimSet{Iss: "shanhu.io"}
+	s := NewTokenSource(NewHS256(rand.Bytes(32), ""), claims, time.Hour)
+	s.Exchange = client
+	s.ExchangePath = "/token"
+	s.ExchangeTimeout = 50 * time.Millisecond
+
+	ctx := context.Background()
+	if _, err := s.Token(ctx); err == nil {
+		t.Fatal("want error from hanging token endpoint, got nil")
+	}
+
+	// The source recovers once the endpoint responds.
+	close(block)
+	tok, err := s.Token(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok != "access-token" {
+		t.Errorf("got token %q, want access-token", tok)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"strings"
+	"time"
+
+	"shanhu.io/misc/errcode"
+)
+
+// Error codes for claim validation failures.
+const (
+	CodeExpired       = "token-expired"
+	CodeNotYetValid   = "token-not-yet-valid"
+	CodeWrongIssuer   = "token-wrong-issuer"
+	CodeWrongAudience = "token-wrong-audience"
+	CodeMissingScope  = "token-missing-scope"
+	CodeMissingClaim  = "token-missing-claim"
+	CodeRevoked       = "token-revoked"
+)
+
+// DefaultLeeway is the grace period that CheckTime allows for clock
+// errors.
+const DefaultLeeway = 5 * time.Minute
+
+// Validator validates the claims of a token. Errors returned by the
+// validator have one of the Code* error codes, so that callers can tell
+// different failures apart.
+type Validator struct {
+	// Issuers is the list of accepted issuers. When it is not empty, the
+	// issuer of the token must be one of them.
+	Issuers []string
+
+	// Audiences is the list of accepted audiences. When it is not empty,
+	// at least one of the audiences of the token must be one of them.
+	Audiences []string
+
+	// Scopes is the list of required scopes. The token must have all of
+	// them in its scope claim.
+	Scopes []string
+
+	// Leeway is the grace period for clock errors when checking time
+	// claims.
+	Leeway time.Duration
+
+	// RequireJTI requires the token to have a "jti" claim.
+	RequireJTI bool
+
+	// Revocations is an optional store of revoked token IDs. When it is
+	// set, the token must have a "jti" claim that is not revoked.
+	// EncodeAndSign and EncodeAndEncrypt do not add the claim; issuers
+	// need to set ClaimSet.Jti, for example with NewJTI. TokenSource sets
+	// it automatically.
+	Revocations RevocationStore
+
+	// OneTimeUse revokes the token after it is validated, so that it
+	// cannot be used again. It requires Revocations to be set.
+	OneTimeUse bool
+
+	// TimeFunc is an optional function for reading the current timestamp.
+	// When it is nil, the validator uses time.Now().
+	TimeFunc func() time.Time
+}
+
+func (v *Validator) now() time.Time {
+	if v.TimeFunc == nil {
+		return time.Now()
+	}
+	return v.TimeFunc()
+}
+
+func hasString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *Validator) checkTime(c *ClaimSet) error {
+	if c.Exp == 0 {
+		return errcode.Errorf(CodeMissingClaim, "missing exp")
+	}
+
+	now := v.now()
+	expires := time.Unix(c.Exp, 0).Add(v.Leeway)
+	if now.After(expires) {
+		return errcode.Errorf(CodeExpired, "token expired")
+	}
+
+	if c.Iat != 0 {
+		issued := time.Unix(c.Iat, 0).Add(-v.Leeway)
+		if now.Before(issued) {
+			return errcode.Errorf(
+				CodeNotYetValid, "token issued in the future",
+			)
+		}
+	}
+	if c.Nbf != 0 {
+		notBefore := time.Unix(c.Nbf, 0).Add(-v.Leeway)
+		if now.Before(notBefore) {
+			return errcode.Errorf(CodeNotYetValid, "token not valid yet")
+		}
+	}
+	return nil
+}
+
+// Validate validates the claim set.
+func (v *Validator) Validate(c *ClaimSet) error {
+	if err := v.checkTime(c); err != nil {
+		return err
+	}
+
+	if len(v.Issuers) > 0 && !hasString(v.Issuers, c.Iss) {
+		return errcode.Errorf(CodeWrongIssuer, "wrong issuer %q", c.Iss)
+	}
+	if len(v.Audiences) > 0 && !c.Aud.ContainsAny(v.Audiences) {
+		return errcode.Errorf(
+			CodeWrongAudience, "wrong audience %q", []string(c.Aud),
+		)
+	}
+
+	if err := CheckScopes(c, v.Scopes); err != nil {
+		return err
+	}
+
+	if (v.RequireJTI || v.Revocations != nil) && c.Jti == "" {
+		return errcode.Errorf(CodeMissingClaim, "missing jti")
+	}
+	return v.checkRevoked(c)
+}
+
+func (v *Validator) checkRevoked(c *ClaimSet) error {
+	if v.Revocations == nil {
+		if v.OneTimeUse {
+			return errcode.Internalf("one time use needs revocation store")
+		}
+		return nil
+	}
+
+	if v.OneTimeUse {
+		first, err := v.Revocations.Revoke(c.Jti, time.Unix(c.Exp, 0))
+		if err != nil {
+			return errcode.Internalf("revoke token: %s", err)
+		}
+		if !first {
+			return errcode.Errorf(CodeRevoked, "token already used")
+		}
+		return nil
+	}
+
+	revoked, err := v.Revocations.IsRevoked(c.Jti)
+	if err != nil {
+		return errcode.Internalf("check revocation: %s", err)
+	}
+	if revoked {
+		return errcode.Errorf(CodeRevoked, "token revoked")
+	}
+	return nil
+}
+
+// CheckScopes checks if the claim set has all the required scopes.
+func CheckScopes(c *ClaimSet, required []string) error {
+	if len(required) == 0 {
+		return nil
+	}
+	scopes := strings.Fields(c.Scope)
+	for _, s := range required {
+		if !hasString(scopes, s) {
+			return errcode.Errorf(CodeMissingScope, "missing scope %q", s)
+		}
+	}
+	return nil
+}
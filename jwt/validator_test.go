@@ -0,0 +1,85 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jwt
+
+import (
+	"testing"
+
+	"time"
+
+	"shanhu.io/misc/errcode/errcodetest"
+)
+
+func TestValidator(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	v := &Validator{
+		Issuers:    []string{"shanhu.io"},
+		Audiences:  []string{"nextcloud", "homedrv"},
+		Scopes:     []string{"read"},
+		Leeway:     time.Minute,
+		RequireJTI: true,
+		TimeFunc:   func() time.Time { return now },
+	}
+
+	good := func() *ClaimSet {
+		return &ClaimSet{
+			Iss:   "shanhu.io",
+			Aud:   Audience{"homedrv"},
+			Scope: "read write",
+			Iat:   now.Unix(),
+			Exp:   now.Add(time.Hour).Unix(),
+			Jti:   "t1",
+		}
+	}
+	if err := v.Validate(good()); err != nil {
+		t.Fatalf("validate good claims: %s", err)
+	}
+
+	for _, test := range []struct {
+		name   string
+		modify func(c *ClaimSet)
+		code   string
+	}{
+		{"expired", func(c *ClaimSet) {
+			c.Exp = now.Add(-2 * time.Minute).Unix()
+		}, CodeExpired},
+		{"future", func(c *ClaimSet) {
+			c.Iat = now.Add(2 * time.Minute).Unix()
+		}, CodeNotYetValid},
+		{"nbf", func(c *ClaimSet) {
+			c.Nbf = now.Add(2 * time.Minute).Unix()
+		}, CodeNotYetValid},
+		{"issuer", func(c *ClaimSet) { c.Iss = "evil.io" }, CodeWrongIssuer},
+		{"audience", func(c *ClaimSet) {
+			c.Aud = Audience{"x"}
+		}, CodeWrongAudience},
+		{"scope", func(c *ClaimSet) { c.Scope = "write" }, CodeMissingScope},
+		{"jti", func(c *ClaimSet) { c.Jti = "" }, CodeMissingClaim},
+		{"exp", func(c *ClaimSet) { c.Exp = 0 }, CodeMissingClaim},
+	} {
+		c := good()
+		test.modify(c)
+		errcodetest.CheckError(t, v.Validate(c), test.code, test.name)
+	}
+
+	// Within leeway.
+	c := good()
+	c.Exp = now.Add(-30 * time.Second).Unix()
+	c.Nbf = now.Add(30 * time.Second).Unix()
+	if err := v.Validate(c); err != nil {
+		t.Errorf("validate claims within leeway: %s", err)
+	}
+}
@@ -17,6 +17,7 @@ package rsautil
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/base64"
@@ -28,8 +29,9 @@ func keyHashStr(h []byte) string {
 	return base64.RawURLEncoding.EncodeToString(h)
 }
 
-// PublicKeyHash returns the public key hash of a key.
-func PublicKeyHash(k *rsa.PublicKey) ([]byte, error) {
+// KeyHash returns the public key hash of a key of any type that SSH
+// supports. The hash is the SHA256 of the key in SSH authorized key format.
+func KeyHash(k crypto.PublicKey) ([]byte, error) {
 	sshPub, err := ssh.NewPublicKey(k)
 	if err != nil {
 		return nil, err
@@ -40,11 +42,22 @@ func PublicKeyHash(k *rsa.PublicKey) ([]byte, error) {
 	return h[:], nil
 }
 
-// PublicKeyHashString returns the public key hash string of a key.
-func PublicKeyHashString(k *rsa.PublicKey) (string, error) {
-	h, err := PublicKeyHash(k)
+// KeyHashString returns the public key hash string of a key of any type
+// that SSH supports.
+func KeyHashString(k crypto.PublicKey) (string, error) {
+	h, err := KeyHash(k)
 	if err != nil {
 		return "", err
 	}
 	return keyHashStr(h), nil
 }
+
+// PublicKeyHash returns the public key hash of a key.
+func PublicKeyHash(k *rsa.PublicKey) ([]byte, error) {
+	return KeyHash(k)
+}
+
+// PublicKeyHashString returns the public key hash string of a key.
+func PublicKeyHashString(k *rsa.PublicKey) (string, error) {
+	return KeyHashString(k)
+}
@@ -0,0 +1,141 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// SessionCookie saves sessions in HTTP cookies. Cookies are HttpOnly, and
+// by default Secure with SameSite=Lax.
+type SessionCookie struct {
+	sessions *Sessions
+	name     string
+
+	Path   string // Cookie path, default is "/".
+	Domain string // Optional cookie domain.
+
+	// Insecure clears the Secure flag of the cookie. It should only be used
+	// for testing on localhost without HTTPS.
+	Insecure bool
+
+	// SameSite is the SameSite mode of the cookie. Default is Lax.
+	SameSite http.SameSite
+
+	// RenewBefore enables sliding renewal. When the session is checked
+	// with less than this remaining time to live, a new session cookie
+	// with the same data is set.
+	RenewBefore time.Duration
+}
+
+// NewSessionCookie creates a session cookie with the given name that saves
+// sessions from s.
+func NewSessionCookie(name string, s *Sessions) *SessionCookie {
+	return &SessionCookie{
+		sessions: s,
+		name:     name,
+	}
+}
+
+func (c *SessionCookie) cookie(v string) *http.Cookie {
+	path := c.Path
+	if path == "" {
+		path = "/"
+	}
+	sameSite := c.SameSite
+	if sameSite == 0 {
+		sameSite = http.SameSiteLaxMode
+	}
+	return &http.Cookie{
+		Name:     c.name,
+		Value:    v,
+		Path:     path,
+		Domain:   c.Domain,
+		Secure:   !c.Insecure,
+		HttpOnly: true,
+		SameSite: sameSite,
+	}
+}
+
+// Set creates a new session with the data and sets it as a cookie. It
+// returns the expire time of the session.
+func (c *SessionCookie) Set(w http.ResponseWriter, data []byte) time.Time {
+	session, expires := c.sessions.New(data, 0)
+	cookie := c.cookie(session)
+	cookie.Expires = expires
+	maxAge := int(expires.Sub(now(c.sessions.TimeFunc)) / time.Second)
+	if maxAge <= 0 {
+		maxAge = -1
+	}
+	cookie.MaxAge = maxAge
+	http.SetCookie(w, cookie)
+	return expires
+}
+
+// SetJSON creates a new session with a JSON marshalable data and sets it as
+// a cookie.
+func (c *SessionCookie) SetJSON(w http.ResponseWriter, data interface{}) (
+	time.Time, error,
+) {
+	bs, err := json.Marshal(data)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return c.Set(w, bs), nil
+}
+
+// Check reads and checks the session cookie in the request. If it is valid,
+// it returns the session data. When w is not nil and the session is about
+// to expire, it renews the session cookie.
+func (c *SessionCookie) Check(w http.ResponseWriter, req *http.Request) (
+	[]byte, bool,
+) {
+	cookie, err := req.Cookie(c.name)
+	if err != nil {
+		return nil, false
+	}
+	data, ttl, ok := c.sessions.Check(cookie.Value)
+	if !ok {
+		return nil, false
+	}
+	if w != nil && c.RenewBefore > 0 && ttl < c.RenewBefore {
+		c.Set(w, data)
+	}
+	return data, true
+}
+
+// CheckJSON checks the session cookie in the request, and unmarshals the
+// session data if it is valid. It will return false if it fails to
+// unmarshal.
+func (c *SessionCookie) CheckJSON(
+	w http.ResponseWriter, req *http.Request, data interface{},
+) bool {
+	bs, ok := c.Check(w, req)
+	if !ok {
+		return false
+	}
+	return json.Unmarshal(bs, data) == nil
+}
+
+// Clear clears the session cookie.
+func (c *SessionCookie) Clear(w http.ResponseWriter) {
+	cookie := c.cookie("")
+	cookie.MaxAge = -1
+	cookie.Expires = time.Unix(0, 0)
+	http.SetCookie(w, cookie)
+}
@@ -0,0 +1,87 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"testing"
+
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+func TestSessionCookie(t *testing.T) {
+	const ttl = time.Hour
+	s := NewSessions(nil, ttl)
+	s.Encoding = Base64URL
+	now := time.Unix(1600000000, 0)
+	s.TimeFunc = func() time.Time { return now }
+
+	c := NewSessionCookie("session", s)
+	c.RenewBefore = 10 * time.Minute
+
+	w := httptest.NewRecorder()
+	if _, err := c.SetJSON(w, "h8liu"); err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("got %d cookies, want 1", len(cookies))
+	}
+	cookie := cookies[0]
+	if !cookie.Secure || !cookie.HttpOnly {
+		t.Errorf("cookie should be secure and http only")
+	}
+	if cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("got same site mode %v, want lax", cookie.SameSite)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookie)
+
+	var user string
+	w = httptest.NewRecorder()
+	if !c.CheckJSON(w, req, &user) {
+		t.Fatal("check session cookie failed")
+	}
+	if user != "h8liu" {
+		t.Errorf("got user %q, want h8liu", user)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Errorf("session cookie renewed too early")
+	}
+
+	now = now.Add(ttl - 5*time.Minute)
+	w = httptest.NewRecorder()
+	if !c.CheckJSON(w, req, &user) {
+		t.Fatal("check session cookie failed")
+	}
+	renewed := w.Result().Cookies()
+	if len(renewed) != 1 {
+		t.Fatalf("session cookie not renewed")
+	}
+	if want := now.Add(ttl).Unix(); renewed[0].Expires.Unix() != want {
+		t.Errorf(
+			"got renewed expiry %s, want %s",
+			renewed[0].Expires, time.Unix(want, 0),
+		)
+	}
+
+	now = now.Add(10 * time.Minute)
+	if c.CheckJSON(nil, req, &user) {
+		t.Errorf("expired session cookie passed check")
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// Encoding is the text encoding of signed tokens.
+type Encoding int
+
+// Token encodings.
+const (
+	Hex       Encoding = iota // Hex encoding, the default.
+	Base64URL                 // Base64 URL encoding without padding.
+)
+
+func (e Encoding) encode(bs []byte) string {
+	if e == Base64URL {
+		return base64.RawURLEncoding.EncodeToString(bs)
+	}
+	return hex.EncodeToString(bs)
+}
+
+func (e Encoding) decode(s string) ([]byte, error) {
+	if e == Base64URL {
+		return base64.RawURLEncoding.DecodeString(s)
+	}
+	return hex.DecodeString(s)
+}
@@ -0,0 +1,236 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"shanhu.io/misc/rsautil"
+)
+
+// Signing algorithms of signed blocks.
+const (
+	AlgRSA     = "rsa-sha256"   // RSA PKCS#1 v1.5 with SHA256.
+	AlgECDSA   = "ecdsa-sha256" // ECDSA P-256 with SHA256, ASN.1 encoded.
+	AlgEd25519 = "ed25519"      // Ed25519.
+)
+
+// SignedBlock is a block of data signed with a private key.
+type SignedBlock struct {
+	// Alg is the signing algorithm. Empty means AlgRSA, for blocks signed
+	// before the field was added.
+	Alg string `json:",omitempty"`
+
+	Data []byte
+	Hash []byte
+	Sig  []byte
+
+	KeyID string `json:",omitempty"`
+}
+
+func (b *SignedBlock) alg() string {
+	if b.Alg == "" {
+		return AlgRSA
+	}
+	return b.Alg
+}
+
+func publicKeyAlg(k crypto.PublicKey) (string, error) {
+	switch k := k.(type) {
+	case *rsa.PublicKey:
+		return AlgRSA, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return "", fmt.Errorf("ecdsa key is not on curve P-256")
+		}
+		return AlgECDSA, nil
+	case ed25519.PublicKey:
+		return AlgEd25519, nil
+	}
+	return "", fmt.Errorf("unsupported key type %T", k)
+}
+
+// ParseAuthorizedKey parses a public key from a line in SSH authorized_keys
+// format. It supports RSA, ECDSA P-256 and Ed25519 keys.
+func ParseAuthorizedKey(bs []byte) (crypto.PublicKey, error) {
+	k, _, _, _, err := ssh.ParseAuthorizedKey(bs)
+	if err != nil {
+		return nil, err
+	}
+	ck, ok := k.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %q", k.Type())
+	}
+	pub := ck.CryptoPublicKey()
+	if _, err := publicKeyAlg(pub); err != nil {
+		return nil, err
+	}
+	return pub, nil
+}
+
+func signTimeWithKey(k crypto.Signer, t time.Time, withNonce bool) (
+	*SignedBlock, error,
+) {
+	pub := k.Public()
+	alg, err := publicKeyAlg(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := timeData(t, withNonce)
+	hash := sha256.Sum256(buf)
+
+	var sig []byte
+	if alg == AlgEd25519 {
+		sig, err = k.Sign(rand.Reader, buf, crypto.Hash(0))
+	} else {
+		sig, err = k.Sign(rand.Reader, hash[:], crypto.SHA256)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sign blob: %s", err)
+	}
+
+	keyID, err := rsautil.KeyHashString(pub)
+	if err != nil {
+		return nil, fmt.Errorf("make key hash: %s", err)
+	}
+
+	return &SignedBlock{
+		Alg:   alg,
+		Data:  buf,
+		Hash:  hash[:],
+		Sig:   sig,
+		KeyID: keyID,
+	}, nil
+}
+
+// SignTimeWithKey signs the current time with the given private key. The
+// key can be an RSA, ECDSA P-256 or Ed25519 private key.
+func SignTimeWithKey(k crypto.Signer) (*SignedBlock, error) {
+	return signTimeWithKey(k, time.Now(), false)
+}
+
+// SignTimeNonceWithKey signs the current time and a random nonce with the
+// given private key, for checkers that have replay protection.
+func SignTimeNonceWithKey(k crypto.Signer) (*SignedBlock, error) {
+	return signTimeWithKey(k, time.Now(), true)
+}
+
+func verifyBlock(k crypto.PublicKey, b *SignedBlock) error {
+	alg, err := publicKeyAlg(k)
+	if err != nil {
+		return err
+	}
+	if b.alg() != alg {
+		return fmt.Errorf("alg is %q, want %q", b.alg(), alg)
+	}
+
+	hash := sha256.Sum256(b.Data)
+	if !bytes.Equal(hash[:], b.Hash) {
+		return fmt.Errorf("hash incorrect")
+	}
+
+	switch k := k.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, b.Hash, b.Sig)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, b.Hash, b.Sig) {
+			return fmt.Errorf("ecdsa verification error")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, b.Data, b.Sig) {
+			return fmt.Errorf("ed25519 verification error")
+		}
+	}
+	return nil
+}
+
+func checkTimeBlock(
+	k crypto.PublicKey, b *SignedBlock, w time.Duration, tnow time.Time,
+	cache *ReplayCache,
+) error {
+	t, nonce, ok := parseTimeData(b.Data)
+	if !ok {
+		return fmt.Errorf("data is not a timestamp")
+	}
+	if !inWindow(t, tnow, w) {
+		return fmt.Errorf("time out of window")
+	}
+	if err := verifyBlock(k, b); err != nil {
+		return err
+	}
+	return checkReplay(cache, w, nonce, t, tnow)
+}
+
+// KeyTimeSigner checks if a time signed with a private key is within a time
+// window of the current time reading.
+type KeyTimeSigner struct {
+	k      crypto.PublicKey
+	window time.Duration
+
+	// TimeFunc is an optional function for reading the current timestamp.
+	// When it is nil, the KeyTimeSigner uses time.Now().
+	TimeFunc func() time.Time
+
+	// ReplayCache is an optional cache for rejecting replayed blocks. When
+	// it is set, blocks must have a nonce, and each block can only pass
+	// the check once.
+	ReplayCache *ReplayCache
+}
+
+// NewKeyTimeSigner creates a new time signer that uses the given public
+// key. The key can be an RSA, ECDSA P-256 or Ed25519 public key.
+func NewKeyTimeSigner(k crypto.PublicKey, w time.Duration) (
+	*KeyTimeSigner, error,
+) {
+	if _, err := publicKeyAlg(k); err != nil {
+		return nil, err
+	}
+	if w < 0 {
+		w = -w
+	}
+	return &KeyTimeSigner{
+		k:      k,
+		window: w,
+	}, nil
+}
+
+// NewAuthorizedKeyTimeSigner creates a new time signer that uses the public
+// key in the SSH authorized_keys line.
+func NewAuthorizedKeyTimeSigner(line []byte, w time.Duration) (
+	*KeyTimeSigner, error,
+) {
+	k, err := ParseAuthorizedKey(line)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyTimeSigner(k, w)
+}
+
+// Check checks if the timestamp is with in the time window.
+func (s *KeyTimeSigner) Check(b *SignedBlock) error {
+	return checkTimeBlock(s.k, b, s.window, now(s.TimeFunc), s.ReplayCache)
+}
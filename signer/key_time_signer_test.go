@@ -0,0 +1,102 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"testing"
+
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func authorizedKeyLine(t *testing.T, k crypto.PublicKey) []byte {
+	t.Helper()
+	pub, err := ssh.NewPublicKey(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ssh.MarshalAuthorizedKey(pub)
+}
+
+func TestKeyTimeSigner(t *testing.T) {
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for _, test := range []struct {
+		alg string
+		key crypto.Signer
+		pub crypto.PublicKey
+	}{
+		{AlgEd25519, edKey, edPub},
+		{AlgECDSA, ecKey, &ecKey.PublicKey},
+	} {
+		line := authorizedKeyLine(t, test.pub)
+		s, err := NewAuthorizedKeyTimeSigner(line, time.Second)
+		if err != nil {
+			t.Fatalf("%s: create signer: %s", test.alg, err)
+		}
+		clock := now
+		s.TimeFunc = func() time.Time { return clock }
+
+		b, err := signTimeWithKey(test.key, now, false)
+		if err != nil {
+			t.Fatalf("%s: sign time: %s", test.alg, err)
+		}
+		if b.Alg != test.alg {
+			t.Errorf("got alg %q, want %q", b.Alg, test.alg)
+		}
+
+		if err := s.Check(b); err != nil {
+			t.Errorf("%s: check: %s", test.alg, err)
+		}
+		clock = now.Add(2 * time.Second)
+		if err := s.Check(b); err == nil {
+			t.Errorf("%s: timestamp should be out of window", test.alg)
+		}
+		clock = now
+
+		b.Sig[0] ^= 1
+		if err := s.Check(b); err == nil {
+			t.Errorf("%s: tampered signature passed check", test.alg)
+		}
+	}
+
+	// Blocks signed by another type of key do not pass.
+	s, err := NewKeyTimeSigner(edPub, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := signTimeWithKey(ecKey, time.Now(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Check(b); err == nil {
+		t.Errorf("ecdsa block passed check with ed25519 key")
+	}
+}
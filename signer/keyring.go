@@ -0,0 +1,119 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"sync"
+
+	"shanhu.io/misc/errcode"
+	"shanhu.io/misc/rand"
+)
+
+const keyVersionLen = 4
+
+// KeyRing is a set of versioned signing keys. It signs with the current key,
+// and verifies with any key in the ring, so that keys can be rotated without
+// invalidating what is signed by the previous keys.
+type KeyRing struct {
+	mu      sync.RWMutex
+	keys    map[uint32][]byte
+	current uint32
+}
+
+// ringKey returns a random key when key is nil, and rejects empty keys,
+// which would make signatures trivial to forge.
+func ringKey(key []byte) ([]byte, error) {
+	if key == nil {
+		return rand.Bytes(32), nil
+	}
+	if len(key) == 0 {
+		return nil, errcode.InvalidArgf("empty key")
+	}
+	return key, nil
+}
+
+// NewKeyRing creates a new key ring with the given key as the current key.
+// When key is nil, a random key is used. Empty keys are rejected.
+func NewKeyRing(version uint32, key []byte) (*KeyRing, error) {
+	key, err := ringKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyRing{
+		keys:    map[uint32][]byte{version: key},
+		current: version,
+	}, nil
+}
+
+// Add adds a key for verifying only. It is often a previous key that might
+// still have live signatures. Empty keys are rejected.
+func (r *KeyRing) Add(version uint32, key []byte) error {
+	if len(key) == 0 {
+		return errcode.InvalidArgf("empty key")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys[version] = key
+	return nil
+}
+
+// Rotate adds a key and uses it as the current key for signing. The
+// previous keys are kept for verifying. When key is nil, a random key is
+// used. Empty keys are rejected.
+func (r *KeyRing) Rotate(version uint32, key []byte) error {
+	key, err := ringKey(key)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys[version] = key
+	r.current = version
+	return nil
+}
+
+// Remove removes a key, so that signatures of this key are no longer
+// valid. The current key cannot be removed, and it returns false if
+// version is the current version.
+func (r *KeyRing) Remove(version uint32) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if version == r.current {
+		return false
+	}
+	delete(r.keys, version)
+	return true
+}
+
+// Current returns the version of the current key.
+func (r *KeyRing) Current() uint32 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current
+}
+
+func (r *KeyRing) currentKey() (uint32, []byte) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current, r.keys[r.current]
+}
+
+func (r *KeyRing) key(version uint32) ([]byte, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	k, ok := r.keys[version]
+	return k, ok
+}
@@ -0,0 +1,103 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"testing"
+
+	"time"
+
+	"shanhu.io/misc/rand"
+)
+
+func TestKeyRing(t *testing.T) {
+	r, err := NewKeyRing(1, rand.Bytes(32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewFromKeyRing(r)
+
+	old := s.SignHex([]byte("old"))
+	if err := r.Rotate(2, rand.Bytes(32)); err != nil {
+		t.Fatal(err)
+	}
+	if r.Current() != 2 {
+		t.Errorf("got current version %d, want 2", r.Current())
+	}
+	cur := s.SignHex([]byte("new"))
+
+	for _, signed := range []string{old, cur} {
+		if ok, _ := s.CheckHex(signed); !ok {
+			t.Errorf("check %q failed", signed)
+		}
+	}
+
+	if r.Remove(2) {
+		t.Errorf("current key should not be removable")
+	}
+	if !r.Remove(1) {
+		t.Errorf("remove previous key failed")
+	}
+	if ok, _ := s.CheckHex(old); ok {
+		t.Errorf("signed with removed key, but still passes")
+	}
+	ok, dat := s.CheckHex(cur)
+	if !ok {
+		t.Errorf("check %q failed", cur)
+	} else if string(dat) != "new" {
+		t.Errorf("got %q, want %q", dat, "new")
+	}
+}
+
+func TestKeyRingSessions(t *testing.T) {
+	r, err := NewKeyRing(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := NewSessionsFromKeyRing(r, time.Hour)
+
+	session, _ := sessions.New([]byte("h8liu"), 0)
+	if err := r.Rotate(2, nil); err != nil {
+		t.Fatal(err)
+	}
+	dat, _, ok := sessions.Check(session)
+	if !ok {
+		t.Fatal("session invalid after key rotation")
+	}
+	if string(dat) != "h8liu" {
+		t.Errorf("got session data %q, want h8liu", dat)
+	}
+}
+
+func TestKeyRingEmptyKey(t *testing.T) {
+	if _, err := NewKeyRing(1, []byte{}); err == nil {
+		t.Error("new key ring with empty key, got nil error")
+	}
+
+	r, err := NewKeyRing(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Rotate(2, []byte{}); err == nil {
+		t.Error("rotate to empty key, got nil error")
+	}
+	if err := r.Add(3, nil); err == nil {
+		t.Error("add nil key, got nil error")
+	}
+	if r.Current() != 1 {
+		t.Errorf("got current version %d, want 1", r.Current())
+	}
+}
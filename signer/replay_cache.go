@@ -0,0 +1,121 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"container/heap"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type replayEntry struct {
+	nonce   string
+	expires time.Time
+}
+
+type replayHeap []*replayEntry
+
+func (h replayHeap) Len() int { return len(h) }
+
+func (h replayHeap) Less(i, j int) bool {
+	return h[i].expires.Before(h[j].expires)
+}
+
+func (h replayHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *replayHeap) Push(x interface{}) {
+	*h = append(*h, x.(*replayEntry))
+}
+
+func (h *replayHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return x
+}
+
+// ReplayCache remembers the nonces of signed timestamps that are seen in
+// the time window of the signer that uses it, and rejects repeats. Entries
+// are evicted once their timestamps are out of the window, as the tokens
+// are rejected by the time check anyways. The cache is bounded; when it is
+// full of entries still in the window, new nonces are rejected.
+type ReplayCache struct {
+	max int
+
+	mu    sync.Mutex
+	seen  map[string]bool
+	queue replayHeap
+}
+
+// NewReplayCache creates a replay cache that holds at most max entries.
+func NewReplayCache(max int) *ReplayCache {
+	return &ReplayCache{
+		max:  max,
+		seen: make(map[string]bool),
+	}
+}
+
+func (c *ReplayCache) evict(tnow time.Time) {
+	for len(c.queue) > 0 && !c.queue[0].expires.After(tnow) {
+		entry := heap.Pop(&c.queue).(*replayEntry)
+		delete(c.seen, entry.nonce)
+	}
+}
+
+// Add records the nonce of a token that is valid until expires. It returns
+// an error if the nonce is already seen, or if the cache is full.
+func (c *ReplayCache) Add(nonce []byte, expires, tnow time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.evict(tnow)
+
+	k := string(nonce)
+	if c.seen[k] {
+		return fmt.Errorf("replayed nonce")
+	}
+	if c.max > 0 && len(c.queue) >= c.max {
+		return fmt.Errorf("replay cache full")
+	}
+	c.seen[k] = true
+	heap.Push(&c.queue, &replayEntry{
+		nonce:   k,
+		expires: expires,
+	})
+	return nil
+}
+
+// Len returns the number of entries in the cache.
+func (c *ReplayCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.queue)
+}
+
+func checkReplay(
+	c *ReplayCache, w time.Duration, nonce []byte, t, tnow time.Time,
+) error {
+	if c == nil {
+		return nil
+	}
+	if nonce == nil {
+		return fmt.Errorf("nonce missing")
+	}
+	return c.Add(nonce, t.Add(w), tnow)
+}
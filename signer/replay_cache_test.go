@@ -0,0 +1,73 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"testing"
+
+	"time"
+)
+
+func TestTimeSignerReplay(t *testing.T) {
+	const window = 5 * time.Second
+	s := NewTimeSigner(nil, window)
+	now := time.Unix(0, 0)
+	s.TimeFunc = func() time.Time { return now }
+	s.ReplayCache = NewReplayCache(2)
+
+	token := s.NonceToken()
+	if !s.Check(token) {
+		t.Fatal("token should be valid")
+	}
+	if s.Check(token) {
+		t.Error("replayed token should be invalid")
+	}
+	if s.Check(s.Token()) {
+		t.Error("token without nonce should be invalid")
+	}
+
+	if !s.Check(s.NonceToken()) {
+		t.Error("another token should be valid")
+	}
+	if s.Check(s.NonceToken()) {
+		t.Error("token should be rejected when cache is full")
+	}
+
+	now = now.Add(window)
+	if !s.Check(s.NonceToken()) {
+		t.Error("token should be valid after old entries are evicted")
+	}
+	if n := s.ReplayCache.Len(); n != 1 {
+		t.Errorf("replay cache has %d entries, want 1", n)
+	}
+}
+
+func TestTimeSignerReplayWindow(t *testing.T) {
+	const window = 10 * time.Minute
+	s := NewTimeSigner(nil, window)
+	now := time.Unix(0, 0)
+	s.TimeFunc = func() time.Time { return now }
+	s.ReplayCache = NewReplayCache(10)
+
+	token := s.NonceToken()
+	if !s.Check(token) {
+		t.Fatal("token should be valid")
+	}
+	now = now.Add(window - time.Second)
+	if s.Check(token) {
+		t.Error("replayed token should be invalid in the signer window")
+	}
+}
@@ -16,26 +16,12 @@
 package signer
 
 import (
-	"bytes"
-	"crypto"
-	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
-	"encoding/binary"
-	"fmt"
 	"time"
-
-	"shanhu.io/misc/rsautil"
 )
 
-// SignedRSABlock is a signed RSA block.
-type SignedRSABlock struct {
-	Data []byte
-	Hash []byte
-	Sig  []byte
-
-	KeyID string `json:",omitempty"`
-}
+// SignedRSABlock is a signed RSA block. It is the same as SignedBlock.
+type SignedRSABlock = SignedBlock
 
 // RSATimeSigner signes the current time, or checks if a signed time
 // is within a time window of the current time reading.
@@ -44,6 +30,11 @@ type RSATimeSigner struct {
 	window time.Duration
 
 	TimeFunc func() time.Time
+
+	// ReplayCache is an optional cache for rejecting replayed blocks. When
+	// it is set, blocks must have a nonce, and each block can only pass
+	// the check once.
+	ReplayCache *ReplayCache
 }
 
 // NewRSATimeSigner creates a new time signer that uses an RSA key.
@@ -59,24 +50,7 @@ func NewRSATimeSigner(k *rsa.PublicKey, w time.Duration) *RSATimeSigner {
 }
 
 func rsaSignTime(k *rsa.PrivateKey, t time.Time) (*SignedRSABlock, error) {
-	buf := make([]byte, timestampLen)
-	binary.LittleEndian.PutUint64(buf, uint64(t.UnixNano()))
-	hash := sha256.Sum256(buf)
-	sig, err := rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, hash[:])
-	if err != nil {
-		return nil, fmt.Errorf("sign blob: %s", err)
-	}
-	keyHash, err := rsautil.PublicKeyHashString(&k.PublicKey)
-	if err != nil {
-		return nil, fmt.Errorf("make key hash: %s", err)
-	}
-
-	return &SignedRSABlock{
-		Data:  buf,
-		Hash:  hash[:],
-		Sig:   sig,
-		KeyID: keyHash,
-	}, nil
+	return signTimeWithKey(k, t, false)
 }
 
 // RSASignTime signes the current time with the given RSA key.
@@ -84,22 +58,15 @@ func RSASignTime(k *rsa.PrivateKey) (*SignedRSABlock, error) {
 	return rsaSignTime(k, time.Now())
 }
 
+// RSASignTimeNonce signes the current time and a random nonce with the
+// given RSA key, for checkers that have replay protection.
+func RSASignTimeNonce(k *rsa.PrivateKey) (*SignedRSABlock, error) {
+	return signTimeWithKey(k, time.Now(), true)
+}
+
 // Check checks if the timestamp is with in the time window.
 func (s *RSATimeSigner) Check(b *SignedRSABlock) error {
-	if len(b.Data) < 8 {
-		return fmt.Errorf("data too short to have a timestamp")
-	}
-	t := time.Unix(0, int64(binary.LittleEndian.Uint64(b.Data)))
-	timeNow := now(s.TimeFunc)
-	if !inWindow(t, timeNow, s.window) {
-		return fmt.Errorf("time out of window")
-	}
-
-	hash := sha256.Sum256(b.Data)
-	if !bytes.Equal(hash[:], b.Hash) {
-		return fmt.Errorf("hash incorrect")
-	}
-	return rsa.VerifyPKCS1v15(s.k, crypto.SHA256, b.Hash, b.Sig)
+	return checkTimeBlock(s.k, b, s.window, now(s.TimeFunc), s.ReplayCache)
 }
 
 // CheckRSATimeSignature checks if the signed RSA block is signed with the
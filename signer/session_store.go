@@ -0,0 +1,187 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"shanhu.io/misc/errcode"
+)
+
+// SessionInfo is the server-side record of a session.
+type SessionInfo struct {
+	ID       string
+	User     string
+	Data     []byte
+	Created  time.Time
+	LastSeen time.Time
+	Expires  time.Time
+	Revoked  bool
+}
+
+// SessionStore saves session records on the server side, so that sessions
+// can be listed and revoked.
+type SessionStore interface {
+	// Create saves a new session.
+	Create(info *SessionInfo) error
+
+	// Get returns the session of the given ID. It returns a not-found
+	// error if the session does not exist.
+	Get(id string) (*SessionInfo, error)
+
+	// Touch updates the last seen time of the session.
+	Touch(id string, t time.Time) error
+
+	// Revoke revokes the session of the given ID.
+	Revoke(id string) error
+
+	// RevokeUser revokes all sessions of the given user.
+	RevokeUser(user string) error
+
+	// List lists all the sessions of the given user, including the revoked
+	// and expired ones that are not purged yet.
+	List(user string) ([]*SessionInfo, error)
+}
+
+// MemSessionStore is a session store in memory. Expired sessions are purged
+// as new sessions are created, at most once a minute.
+type MemSessionStore struct {
+	// TimeFunc is an optional function for reading the current timestamp.
+	// When it is nil, the store uses time.Now().
+	TimeFunc func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]*SessionInfo
+	purged   time.Time
+}
+
+// NewMemSessionStore creates a new session store in memory.
+func NewMemSessionStore() *MemSessionStore {
+	return &MemSessionStore{
+		sessions: make(map[string]*SessionInfo),
+	}
+}
+
+func copySessionInfo(info *SessionInfo) *SessionInfo {
+	cp := *info
+	return &cp
+}
+
+const memSessionPurgeInterval = time.Minute
+
+func (s *MemSessionStore) purge() {
+	t := now(s.TimeFunc)
+	if t.Sub(s.purged) < memSessionPurgeInterval {
+		return
+	}
+	for id, info := range s.sessions {
+		if !t.Before(info.Expires) {
+			delete(s.sessions, id)
+		}
+	}
+	s.purged = t
+}
+
+// Create saves a new session.
+func (s *MemSessionStore) Create(info *SessionInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge()
+	if _, ok := s.sessions[info.ID]; ok {
+		return errcode.InvalidArgf("session %q already exists", info.ID)
+	}
+	s.sessions[info.ID] = copySessionInfo(info)
+	return nil
+}
+
+func (s *MemSessionStore) get(id string) (*SessionInfo, error) {
+	info, ok := s.sessions[id]
+	if !ok {
+		return nil, errcode.NotFoundf("session %q not found", id)
+	}
+	return info, nil
+}
+
+// Get returns the session of the given ID.
+func (s *MemSessionStore) Get(id string) (*SessionInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := s.get(id)
+	if err != nil {
+		return nil, err
+	}
+	return copySessionInfo(info), nil
+}
+
+// Touch updates the last seen time of the session.
+func (s *MemSessionStore) Touch(id string, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	info.LastSeen = t
+	return nil
+}
+
+// Revoke revokes the session of the given ID.
+func (s *MemSessionStore) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	info.Revoked = true
+	return nil
+}
+
+// RevokeUser revokes all sessions of the given user.
+func (s *MemSessionStore) RevokeUser(user string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, info := range s.sessions {
+		if info.User == user {
+			info.Revoked = true
+		}
+	}
+	return nil
+}
+
+// List lists all the sessions of the given user, ordered by creation time.
+func (s *MemSessionStore) List(user string) ([]*SessionInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ret []*SessionInfo
+	for _, info := range s.sessions {
+		if info.User == user {
+			ret = append(ret, copySessionInfo(info))
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Created.Before(ret[j].Created)
+	})
+	return ret, nil
+}
@@ -17,19 +17,29 @@ package signer
 
 import (
 	"bytes"
+	"crypto/cipher"
 	"encoding/binary"
 	"encoding/json"
 	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"shanhu.io/misc/rand"
 )
 
 // Sessions signs a session data so that the server can run statelessly.
+// In encrypted mode, the session data is also encrypted, so that it is not
+// readable by the client.
 type Sessions struct {
-	s   *Signer
-	ttl time.Duration
+	s    *Signer
+	aead cipher.AEAD
+	ttl  time.Duration
 
 	// TimeFunc is an optional function for reading the current timestamp.
 	// When it is nil, the Sessions object uses time.Now().
 	TimeFunc func() time.Time
+
+	// Encoding is the encoding of the session strings. Default is Hex.
+	Encoding Encoding
 }
 
 // NewSessions creates a new session store.
@@ -40,6 +50,62 @@ func NewSessions(key []byte, ttl time.Duration) *Sessions {
 	}
 }
 
+// NewSessionsFromKeyRing creates a new session store that signs with the
+// key ring. Sessions signed with previous keys in the ring are still valid
+// after the key is rotated.
+func NewSessionsFromKeyRing(r *KeyRing, ttl time.Duration) *Sessions {
+	return &Sessions{
+		s:   NewFromKeyRing(r),
+		ttl: ttl,
+	}
+}
+
+// NewEncryptedSessions creates a new session store that encrypts the
+// session data with XChaCha20-Poly1305. The key must be 32 bytes. When key
+// is nil, a random key is used.
+func NewEncryptedSessions(key []byte, ttl time.Duration) (*Sessions, error) {
+	if key == nil {
+		key = rand.Bytes(chacha20poly1305.KeySize)
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Sessions{
+		aead: aead,
+		ttl:  ttl,
+	}, nil
+}
+
+func (s *Sessions) seal(bs []byte) string {
+	if s.aead == nil {
+		return s.Encoding.encode(s.s.Sign(bs))
+	}
+	nonce := rand.Bytes(s.aead.NonceSize())
+	return s.Encoding.encode(s.aead.Seal(nonce, nonce, bs, nil))
+}
+
+func (s *Sessions) open(session string) ([]byte, bool) {
+	if s.aead == nil {
+		ok, bs := s.s.checkEncoded(session, s.Encoding)
+		return bs, ok
+	}
+
+	bs, err := s.Encoding.decode(session)
+	if err != nil {
+		return nil, false
+	}
+	n := s.aead.NonceSize()
+	if len(bs) < n {
+		return nil, false
+	}
+	ret, err := s.aead.Open(nil, bs[:n], bs[n:], nil)
+	if err != nil {
+		return nil, false
+	}
+	return ret, true
+}
+
 // New creates a new session with some data.
 func (s *Sessions) New(data []byte, ttl time.Duration) (string, time.Time) {
 	buf := new(bytes.Buffer)
@@ -58,7 +124,7 @@ func (s *Sessions) New(data []byte, ttl time.Duration) (string, time.Time) {
 		buf.Write(data)
 	}
 
-	return s.s.SignHex(buf.Bytes()), expires
+	return s.seal(buf.Bytes()), expires
 }
 
 // NewJSON creates a new session with a JSON marshallabe data.
@@ -75,7 +141,7 @@ func (s *Sessions) NewJSON(data interface{}) (string, time.Time, error) {
 
 // Check checks if it is a signed data
 func (s *Sessions) Check(session string) ([]byte, time.Duration, bool) {
-	ok, bs := s.s.CheckHex(session)
+	bs, ok := s.open(session)
 	if !ok {
 		return nil, 0, false
 	}
@@ -18,6 +18,8 @@ package signer
 import (
 	"testing"
 
+	"bytes"
+	"encoding/hex"
 	"time"
 )
 
@@ -51,3 +53,48 @@ func TestStatesExpire(t *testing.T) {
 		t.Errorf("check passed, should fail because of time out")
 	}
 }
+
+func TestEncryptedSessions(t *testing.T) {
+	const ttl = time.Second
+	s, err := NewEncryptedSessions(nil, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(0, 0)
+	s.TimeFunc = func() time.Time { return now }
+
+	type user struct {
+		ID   string
+		Role string
+	}
+	session, _, err := s.NewJSON(&user{ID: "h8liu", Role: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := hex.DecodeString(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("h8liu")) {
+		t.Errorf("session data is not encrypted")
+	}
+
+	got := new(user)
+	if !s.CheckJSON(session, got) {
+		t.Fatalf("check on session %q failed", session)
+	}
+	if got.ID != "h8liu" || got.Role != "admin" {
+		t.Errorf("got session data %+v", got)
+	}
+
+	raw[len(raw)-1] ^= 1
+	if s.CheckJSON(hex.EncodeToString(raw), got) {
+		t.Errorf("check passed on tampered session")
+	}
+
+	now = now.Add(ttl)
+	if s.CheckJSON(session, got) {
+		t.Errorf("check passed, should fail because of time out")
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"shanhu.io/misc/errcode"
+)
+
+// Query parameters added to signed URLs.
+const (
+	URLExpiresParam   = "expires"
+	URLSignatureParam = "signature"
+)
+
+// Errors of verifying signed URLs.
+var (
+	ErrURLNotSigned = errcode.Unauthorizedf("url not signed")
+	ErrURLTampered  = errcode.Unauthorizedf("url signature invalid")
+	ErrURLExpired   = errcode.Unauthorizedf("url expired")
+)
+
+// URLSigner signs URLs that expire, such as download links. The signature
+// covers the method, the path, the expire time and the selected query
+// parameters.
+type URLSigner struct {
+	s      *Signer
+	params []string
+
+	// TimeFunc is an optional function for reading the current timestamp.
+	// When it is nil, the URLSigner uses time.Now().
+	TimeFunc func() time.Time
+}
+
+// NewURLSigner creates a URL signer that signs with s. The values of the
+// given query parameters are covered by the signature; other query
+// parameters are not.
+func NewURLSigner(s *Signer, params ...string) *URLSigner {
+	ps := make([]string, len(params))
+	copy(ps, params)
+	sort.Strings(ps)
+	return &URLSigner{s: s, params: ps}
+}
+
+func (s *URLSigner) canonical(
+	method string, u *url.URL, expires string,
+) []byte {
+	q := u.Query()
+	selected := make(url.Values)
+	for _, p := range s.params {
+		if vs, ok := q[p]; ok {
+			selected[p] = vs
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	for _, s := range []string{
+		method, u.EscapedPath(), expires, selected.Encode(),
+	} {
+		buf.WriteString(s)
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
+
+// Sign returns a copy of u with the expire time and the signature appended
+// as query parameters. The URL expires after ttl.
+func (s *URLSigner) Sign(
+	method string, u *url.URL, ttl time.Duration,
+) *url.URL {
+	expires := now(s.TimeFunc).Add(ttl).Unix()
+	expiresStr := strconv.FormatInt(expires, 10)
+
+	cp := *u
+	q := cp.Query()
+	q.Del(URLSignatureParam)
+	q.Set(URLExpiresParam, expiresStr)
+
+	dat := s.canonical(method, &cp, expiresStr)
+	signed := s.s.Sign(dat)
+
+	// The signature is the signed blob without the data, so that the URL
+	// does not carry the canonical data itself.
+	n := len(signed)
+	sig := make([]byte, 0, n-len(dat))
+	sig = append(sig, signed[:n-len(dat)-sha256.Size]...)
+	sig = append(sig, signed[n-sha256.Size:]...)
+
+	q.Set(URLSignatureParam, base64.RawURLEncoding.EncodeToString(sig))
+	cp.RawQuery = q.Encode()
+	return &cp
+}
+
+// Verify checks if the URL is signed for the method and not expired.
+func (s *URLSigner) Verify(method string, u *url.URL) error {
+	q := u.Query()
+	sigStr := q.Get(URLSignatureParam)
+	expiresStr := q.Get(URLExpiresParam)
+	if sigStr == "" || expiresStr == "" {
+		return ErrURLNotSigned
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(sigStr)
+	if err != nil || len(sig) < sha256.Size {
+		return ErrURLTampered
+	}
+	dat := s.canonical(method, u, expiresStr)
+
+	n := len(sig)
+	signed := make([]byte, 0, n+len(dat))
+	signed = append(signed, sig[:n-sha256.Size]...)
+	signed = append(signed, dat...)
+	signed = append(signed, sig[n-sha256.Size:]...)
+	if ok, _ := s.s.Check(signed); !ok {
+		return ErrURLTampered
+	}
+
+	expires, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil {
+		return ErrURLTampered
+	}
+	if !now(s.TimeFunc).Before(time.Unix(expires, 0)) {
+		return ErrURLExpired
+	}
+	return nil
+}
+
+// VerifyRequest checks if the URL of the request is signed for the method
+// of the request and not expired.
+func (s *URLSigner) VerifyRequest(req *http.Request) error {
+	return s.Verify(req.Method, req.URL)
+}
@@ -0,0 +1,104 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"testing"
+
+	"net/http/httptest"
+	"net/url"
+	"time"
+)
+
+func TestURLSigner(t *testing.T) {
+	r, err := NewKeyRing(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewURLSigner(NewFromKeyRing(r), "file")
+	now := time.Unix(1600000000, 0)
+	s.TimeFunc = func() time.Time { return now }
+
+	u, err := url.Parse("https://shanhu.io/download?file=a.tar&lang=en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := s.Sign("GET", u, time.Minute)
+	t.Log(signed)
+
+	req := httptest.NewRequest("GET", signed.String(), nil)
+	if err := s.VerifyRequest(req); err != nil {
+		t.Fatalf("verify signed url: %s", err)
+	}
+
+	// Parameters that are not signed can change.
+	q := signed.Query()
+	q.Set("lang", "zh")
+	changed := *signed
+	changed.RawQuery = q.Encode()
+	if err := s.Verify("GET", &changed); err != nil {
+		t.Errorf("verify url with unsigned param changed: %s", err)
+	}
+
+	// Keys can be rotated.
+	if err := r.Rotate(2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Verify("GET", signed); err != nil {
+		t.Errorf("verify after key rotation: %s", err)
+	}
+
+	tamper := func(k, v string) *url.URL {
+		q := signed.Query()
+		if v == "" {
+			q.Del(k)
+		} else {
+			q.Set(k, v)
+		}
+		cp := *signed
+		cp.RawQuery = q.Encode()
+		return &cp
+	}
+	otherPath := *signed
+	otherPath.Path = "/upload"
+
+	for _, test := range []struct {
+		name   string
+		method string
+		u      *url.URL
+		want   error
+	}{
+		{"method", "PUT", signed, ErrURLTampered},
+		{"path", "GET", &otherPath, ErrURLTampered},
+		{"param", "GET", tamper("file", "b.tar"), ErrURLTampered},
+		{"expires", "GET", tamper(URLExpiresParam, "1700000000"),
+			ErrURLTampered},
+		{"signature", "GET", tamper(URLSignatureParam, "abcd"),
+			ErrURLTampered},
+		{"no signature", "GET", tamper(URLSignatureParam, ""),
+			ErrURLNotSigned},
+		{"not signed", "GET", u, ErrURLNotSigned},
+	} {
+		if err := s.Verify(test.method, test.u); err != test.want {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.want)
+		}
+	}
+
+	now = now.Add(time.Minute)
+	if err := s.Verify("GET", signed); err != ErrURLExpired {
+		t.Errorf("got error %v, want %v", err, ErrURLExpired)
+	}
+}
@@ -19,15 +19,16 @@ import (
 	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
-	"encoding/hex"
+	"encoding/binary"
 	"encoding/json"
 
 	"shanhu.io/misc/rand"
 )
 
-// Signer is a signer that contains a secrect key.
+// Signer is a signer that contains a secrect key, or a key ring.
 type Signer struct {
-	key []byte
+	key  []byte
+	ring *KeyRing
 }
 
 // New creates a signing pen.
@@ -38,8 +39,15 @@ func New(key []byte) *Signer {
 	return &Signer{key: key}
 }
 
-func (s *Signer) hash(dat []byte) []byte {
-	m := hmac.New(sha256.New, s.key)
+// NewFromKeyRing creates a signing pen that signs with the current key of
+// the key ring. The signed blob carries the key version as a prefix, and
+// is verified with the key of that version.
+func NewFromKeyRing(r *KeyRing) *Signer {
+	return &Signer{ring: r}
+}
+
+func hmacSum(key, dat []byte) []byte {
+	m := hmac.New(sha256.New, key)
 	m.Write(dat)
 	return m.Sum(nil)
 }
@@ -47,9 +55,17 @@ func (s *Signer) hash(dat []byte) []byte {
 // Sign signs a blob and returns the combination of the data and the signature.
 func (s *Signer) Sign(dat []byte) []byte {
 	buf := new(bytes.Buffer)
+	key := s.key
+	if s.ring != nil {
+		version, k := s.ring.currentKey()
+		var v [keyVersionLen]byte
+		binary.LittleEndian.PutUint32(v[:], version)
+		buf.Write(v[:])
+		key = k
+	}
 	buf.Write(dat)
 
-	h := s.hash(buf.Bytes())
+	h := hmacSum(key, buf.Bytes())
 	buf.Write(h)
 
 	return buf.Bytes()
@@ -69,34 +85,66 @@ func (s *Signer) SignJSON(dat interface{}) ([]byte, error) {
 // SignHex signs a blob and returns the data along with the signature in a hex
 // string.
 func (s *Signer) SignHex(dat []byte) string {
-	return hex.EncodeToString(s.Sign(dat))
+	return Hex.encode(s.Sign(dat))
 }
 
 // SignHexJSON signs a JSON marshalable blob and returns the data along with
 // the signature in a hex string.
 func (s *Signer) SignHexJSON(dat interface{}) (string, error) {
+	return s.signEncodedJSON(dat, Hex)
+}
+
+// SignBase64 signs a blob and returns the data along with the signature in
+// a base64 URL encoded string. It is shorter than SignHex.
+func (s *Signer) SignBase64(dat []byte) string {
+	return Base64URL.encode(s.Sign(dat))
+}
+
+// SignBase64JSON signs a JSON marshalable blob and returns the data along
+// with the signature in a base64 URL encoded string.
+func (s *Signer) SignBase64JSON(dat interface{}) (string, error) {
+	return s.signEncodedJSON(dat, Base64URL)
+}
+
+func (s *Signer) signEncodedJSON(dat interface{}, enc Encoding) (
+	string, error,
+) {
 	bs, err := s.SignJSON(dat)
 	if err != nil {
 		return "", err
 	}
-	return hex.EncodeToString(bs), nil
+	return enc.encode(bs), nil
 }
 
 // Check verifies if the signed blob is valid. If it is valid, it returns the
 // original data that is protected by the signature.
 func (s *Signer) Check(bs []byte) (bool, []byte) {
 	n := len(bs)
-	if n < sha256.Size {
+	key := s.key
+	prefix := 0
+	if s.ring != nil {
+		if n < keyVersionLen {
+			return false, nil
+		}
+		version := binary.LittleEndian.Uint32(bs[:keyVersionLen])
+		k, ok := s.ring.key(version)
+		if !ok {
+			return false, nil
+		}
+		key = k
+		prefix = keyVersionLen
+	}
+	if n < prefix+sha256.Size {
 		return false, nil
 	}
 
-	dat := bs[:n-sha256.Size]
+	signed := bs[:n-sha256.Size]
 	hashGot := bs[n-sha256.Size:]
-	hashWant := s.hash(dat)
+	hashWant := hmacSum(key, signed)
 	if !hmac.Equal(hashGot, hashWant) {
 		return false, nil
 	}
-	return true, dat
+	return true, signed[prefix:]
 }
 
 // CheckJSON verifies if the signed blob is valid, and if it is, unmarshals
@@ -112,19 +160,41 @@ func (s *Signer) CheckJSON(bs []byte, dat interface{}) (bool, error) {
 // CheckHexJSON verifies if the signed blob is valid, and if it is, unmarshals
 // the original data into dat.
 func (s *Signer) CheckHexJSON(str string, dat interface{}) (bool, error) {
-	ok, bs := s.CheckHex(str)
-	if !ok {
-		return false, nil
-	}
-	return true, json.Unmarshal(bs, dat)
+	return s.checkEncodedJSON(str, Hex, dat)
 }
 
 // CheckHex verifies if the signed blob is valid, and if it is, returns the
 // original data that is protected by the signature.
 func (s *Signer) CheckHex(str string) (bool, []byte) {
-	bs, err := hex.DecodeString(str)
+	return s.checkEncoded(str, Hex)
+}
+
+// CheckBase64JSON verifies if the base64 URL encoded signed blob is valid,
+// and if it is, unmarshals the original data into dat.
+func (s *Signer) CheckBase64JSON(str string, dat interface{}) (bool, error) {
+	return s.checkEncodedJSON(str, Base64URL, dat)
+}
+
+// CheckBase64 verifies if the base64 URL encoded signed blob is valid, and
+// if it is, returns the original data that is protected by the signature.
+func (s *Signer) CheckBase64(str string) (bool, []byte) {
+	return s.checkEncoded(str, Base64URL)
+}
+
+func (s *Signer) checkEncoded(str string, enc Encoding) (bool, []byte) {
+	bs, err := enc.decode(str)
 	if err != nil {
 		return false, nil
 	}
 	return s.Check(bs)
 }
+
+func (s *Signer) checkEncodedJSON(str string, enc Encoding, dat interface{}) (
+	bool, error,
+) {
+	ok, bs := s.checkEncoded(str, enc)
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(bs, dat)
+}
@@ -41,6 +41,17 @@ func testSigner(t *testing.T, k []byte) {
 		} else if !reflect.DeepEqual(dat, bs) {
 			t.Errorf("got %v, want %v", dat, bs)
 		}
+
+		b := s.SignBase64(bs)
+		ok, dat = s.CheckBase64(b)
+		if !ok {
+			t.Error("check base64 failed")
+		} else if !reflect.DeepEqual(dat, bs) {
+			t.Errorf("got %v, want %v", dat, bs)
+		}
+		if len(b) >= len(h) && len(h) > 0 {
+			t.Errorf("base64 %q is not shorter than hex %q", b, h)
+		}
 	}
 
 	os := func(s string) { o([]byte(s)) }
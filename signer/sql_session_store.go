@@ -0,0 +1,198 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"shanhu.io/misc/errcode"
+	"shanhu.io/misc/sqlx"
+)
+
+// SQLSessionStore is a session store saved in a SQL table.
+type SQLSessionStore struct {
+	db    *sqlx.DB
+	table string
+}
+
+// NewSQLSessionStore creates a session store that uses the given table in
+// the database.
+func NewSQLSessionStore(db *sqlx.DB, table string) *SQLSessionStore {
+	return &SQLSessionStore{db: db, table: table}
+}
+
+// CreateTable creates the table if it does not exist.
+func (s *SQLSessionStore) CreateTable() error {
+	q := fmt.Sprintf(
+		"create table if not exists %s ("+
+			"id text primary key, "+
+			"user_id text not null, "+
+			"data text not null, "+
+			"created bigint not null, "+
+			"last_seen bigint not null, "+
+			"expires bigint not null, "+
+			"revoked bool not null)",
+		s.table,
+	)
+	if _, err := s.db.X(q); err != nil {
+		return err
+	}
+	q = fmt.Sprintf(
+		"create index if not exists %s_user on %s (user_id)",
+		s.table, s.table,
+	)
+	_, err := s.db.X(q)
+	return err
+}
+
+func unixNano(t int64) time.Time { return time.Unix(0, t) }
+
+const sqlSessionColumns = "id, user_id, data, created, last_seen, " +
+	"expires, revoked"
+
+type sqlSessionRow struct {
+	id, user, data             string
+	created, lastSeen, expires int64
+	revoked                    bool
+}
+
+func (r *sqlSessionRow) fields() []interface{} {
+	return []interface{}{
+		&r.id, &r.user, &r.data, &r.created, &r.lastSeen, &r.expires,
+		&r.revoked,
+	}
+}
+
+func (r *sqlSessionRow) info() (*SessionInfo, error) {
+	data, err := base64.StdEncoding.DecodeString(r.data)
+	if err != nil {
+		return nil, errcode.Internalf("decode session data: %s", err)
+	}
+	return &SessionInfo{
+		ID:       r.id,
+		User:     r.user,
+		Data:     data,
+		Created:  unixNano(r.created),
+		LastSeen: unixNano(r.lastSeen),
+		Expires:  unixNano(r.expires),
+		Revoked:  r.revoked,
+	}, nil
+}
+
+// Create saves a new session. Expired sessions are not purged
+// automatically; call Purge periodically to remove them.
+func (s *SQLSessionStore) Create(info *SessionInfo) error {
+	q := fmt.Sprintf(
+		"insert into %s (%s) values ($1, $2, $3, $4, $5, $6, $7)",
+		s.table, sqlSessionColumns,
+	)
+	_, err := s.db.X(
+		q, info.ID, info.User,
+		base64.StdEncoding.EncodeToString(info.Data),
+		info.Created.UnixNano(), info.LastSeen.UnixNano(),
+		info.Expires.UnixNano(), info.Revoked,
+	)
+	return err
+}
+
+// Get returns the session of the given ID.
+func (s *SQLSessionStore) Get(id string) (*SessionInfo, error) {
+	q := fmt.Sprintf(
+		"select %s from %s where id=$1", sqlSessionColumns, s.table,
+	)
+	row := new(sqlSessionRow)
+	ok, err := s.db.Q1(q, id).Scan(row.fields()...)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errcode.NotFoundf("session %q not found", id)
+	}
+	return row.info()
+}
+
+func (s *SQLSessionStore) update(q, id string, args ...interface{}) error {
+	res, err := s.db.X(q, append(args, id)...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return sqlx.Error(q, err)
+	}
+	if n == 0 {
+		return errcode.NotFoundf("session %q not found", id)
+	}
+	return nil
+}
+
+// Touch updates the last seen time of the session.
+func (s *SQLSessionStore) Touch(id string, t time.Time) error {
+	q := fmt.Sprintf("update %s set last_seen=$1 where id=$2", s.table)
+	return s.update(q, id, t.UnixNano())
+}
+
+// Revoke revokes the session of the given ID.
+func (s *SQLSessionStore) Revoke(id string) error {
+	q := fmt.Sprintf("update %s set revoked=$1 where id=$2", s.table)
+	return s.update(q, id, true)
+}
+
+// RevokeUser revokes all sessions of the given user.
+func (s *SQLSessionStore) RevokeUser(user string) error {
+	q := fmt.Sprintf("update %s set revoked=$1 where user_id=$2", s.table)
+	_, err := s.db.X(q, true, user)
+	return err
+}
+
+// List lists all the sessions of the given user, ordered by creation time.
+func (s *SQLSessionStore) List(user string) ([]*SessionInfo, error) {
+	q := fmt.Sprintf(
+		"select %s from %s where user_id=$1 order by created",
+		sqlSessionColumns, s.table,
+	)
+	rows, err := s.db.Q(q, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []*SessionInfo
+	for rows.Next() {
+		row := new(sqlSessionRow)
+		if err := rows.Scan(row.fields()...); err != nil {
+			return nil, sqlx.Error(q, err)
+		}
+		info, err := row.info()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, info)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, sqlx.Error(q, err)
+	}
+	return ret, nil
+}
+
+// Purge removes the sessions that expired before t.
+func (s *SQLSessionStore) Purge(t time.Time) error {
+	q := fmt.Sprintf("delete from %s where expires<$1", s.table)
+	_, err := s.db.X(q, t.UnixNano())
+	return err
+}
@@ -0,0 +1,162 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"testing"
+
+	"path/filepath"
+	"reflect"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"shanhu.io/misc/errcode"
+	"shanhu.io/misc/sqlx"
+)
+
+func newTestSQLSessionStore(t *testing.T) *SQLSessionStore {
+	db, err := sqlx.OpenSqlite3(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	s := NewSQLSessionStore(db, "sessions")
+	if err := s.CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSQLSessionStore(t *testing.T) {
+	s := newTestSQLSessionStore(t)
+
+	now := time.Unix(1600000000, 0)
+	infos := []*SessionInfo{{
+		ID:       "s1",
+		User:     "h8liu",
+		Data:     []byte("laptop"),
+		Created:  now,
+		LastSeen: now,
+		Expires:  now.Add(time.Hour),
+	}, {
+		ID:       "s2",
+		User:     "h8liu",
+		Data:     []byte("phone"),
+		Created:  now.Add(time.Minute),
+		LastSeen: now.Add(time.Minute),
+		Expires:  now.Add(2 * time.Hour),
+	}, {
+		ID:       "s3",
+		User:     "other",
+		Created:  now,
+		LastSeen: now,
+		Expires:  now.Add(time.Hour),
+	}}
+	for _, info := range infos {
+		if err := s.Create(info); err != nil {
+			t.Fatalf("create %q: %s", info.ID, err)
+		}
+	}
+	if err := s.Create(infos[0]); err == nil {
+		t.Error("create duplicated session, got nil error")
+	}
+
+	get := func(id string) *SessionInfo {
+		t.Helper()
+		info, err := s.Get(id)
+		if err != nil {
+			t.Fatalf("get %q: %s", id, err)
+		}
+		return info
+	}
+	checkNotFound := func(id string) {
+		t.Helper()
+		if _, err := s.Get(id); !errcode.IsNotFound(err) {
+			t.Errorf("get %q, want not found, got %v", id, err)
+		}
+	}
+
+	got := get("s1")
+	if got.ID != "s1" || got.User != "h8liu" ||
+		string(got.Data) != "laptop" || !got.Created.Equal(now) ||
+		!got.Expires.Equal(now.Add(time.Hour)) || got.Revoked {
+		t.Errorf("got session %+v, want %+v", got, infos[0])
+	}
+	checkNotFound("s4")
+
+	seen := now.Add(5 * time.Minute)
+	if err := s.Touch("s1", seen); err != nil {
+		t.Fatal(err)
+	}
+	if got := get("s1"); !got.LastSeen.Equal(seen) {
+		t.Errorf("got last seen %s, want %s", got.LastSeen, seen)
+	}
+	if err := s.Touch("s4", seen); !errcode.IsNotFound(err) {
+		t.Errorf("touch missing session, got %v", err)
+	}
+
+	if err := s.Revoke("s1"); err != nil {
+		t.Fatal(err)
+	}
+	if !get("s1").Revoked {
+		t.Error("session s1 not revoked")
+	}
+	if get("s2").Revoked {
+		t.Error("session s2 revoked")
+	}
+	if err := s.Revoke("s4"); !errcode.IsNotFound(err) {
+		t.Errorf("revoke missing session, got %v", err)
+	}
+
+	if err := s.RevokeUser("h8liu"); err != nil {
+		t.Fatal(err)
+	}
+	list, err := s.List("h8liu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, info := range list {
+		ids = append(ids, info.ID)
+		if !info.Revoked {
+			t.Errorf("session %q not revoked", info.ID)
+		}
+	}
+	if want := []string{"s1", "s2"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("list got %q, want %q", ids, want)
+	}
+	if get("s3").Revoked {
+		t.Error("session of another user revoked")
+	}
+
+	// Expired sessions stay until purged.
+	expired := now.Add(90 * time.Minute)
+	if got := get("s3"); !got.Expires.Before(expired) {
+		t.Errorf("session s3 expires at %s, want expired", got.Expires)
+	}
+	if err := s.Purge(expired); err != nil {
+		t.Fatal(err)
+	}
+	checkNotFound("s1")
+	checkNotFound("s3")
+	get("s2")
+}
+
+func TestSQLStoredSessions(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	testStoredSessions(t, newTestSQLSessionStore(t), &now)
+}
@@ -0,0 +1,145 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"encoding/json"
+	"time"
+
+	"shanhu.io/misc/errcode"
+	"shanhu.io/misc/rand"
+)
+
+var (
+	_ SessionStore = (*MemSessionStore)(nil)
+	_ SessionStore = (*SQLSessionStore)(nil)
+)
+
+// StoredSessions saves the session data in a session store. The client only
+// gets a signed opaque session ID, and the session can be revoked on the
+// server side.
+type StoredSessions struct {
+	sessions *Sessions
+	store    SessionStore
+}
+
+// NewStoredSessions creates a new stored session manager. Session IDs are
+// signed with s, and session records are saved in store.
+func NewStoredSessions(s *Sessions, store SessionStore) *StoredSessions {
+	return &StoredSessions{
+		sessions: s,
+		store:    store,
+	}
+}
+
+// New creates a new session for the user with some data.
+func (s *StoredSessions) New(user string, data []byte, ttl time.Duration) (
+	string, time.Time, error,
+) {
+	id := rand.HexBytes(16)
+	session, expires := s.sessions.New([]byte(id), ttl)
+	t := now(s.sessions.TimeFunc)
+	info := &SessionInfo{
+		ID:       id,
+		User:     user,
+		Data:     data,
+		Created:  t,
+		LastSeen: t,
+		Expires:  expires,
+	}
+	if err := s.store.Create(info); err != nil {
+		return "", time.Time{}, errcode.Annotate(err, "create session")
+	}
+	return session, expires, nil
+}
+
+// NewJSON creates a new session for the user with a JSON marshalable data.
+func (s *StoredSessions) NewJSON(user string, data interface{}) (
+	string, time.Time, error,
+) {
+	bs, err := json.Marshal(data)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return s.New(user, bs, 0)
+}
+
+func (s *StoredSessions) id(session string) (string, error) {
+	id, _, ok := s.sessions.Check(session)
+	if !ok {
+		return "", errcode.Unauthorizedf("invalid session")
+	}
+	return string(id), nil
+}
+
+// Check checks if the session is valid and not revoked. If it is, it
+// updates the last seen time of the session, and returns the session
+// record.
+func (s *StoredSessions) Check(session string) (*SessionInfo, error) {
+	id, err := s.id(session)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.store.Get(id)
+	if err != nil {
+		if errcode.IsNotFound(err) {
+			return nil, errcode.Unauthorizedf("session not found")
+		}
+		return nil, err
+	}
+	if info.Revoked {
+		return nil, errcode.Unauthorizedf("session revoked")
+	}
+
+	t := now(s.sessions.TimeFunc)
+	if !t.Before(info.Expires) {
+		return nil, errcode.Unauthorizedf("session expired")
+	}
+	if err := s.store.Touch(id, t); err != nil {
+		return nil, errcode.Annotate(err, "touch session")
+	}
+	info.LastSeen = t
+	return info, nil
+}
+
+// CheckJSON checks if the session is valid and not revoked, and unmarshals
+// the session data if it is.
+func (s *StoredSessions) CheckJSON(session string, data interface{}) error {
+	info, err := s.Check(session)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(info.Data, data)
+}
+
+// Revoke revokes the session.
+func (s *StoredSessions) Revoke(session string) error {
+	id, err := s.id(session)
+	if err != nil {
+		return err
+	}
+	return s.store.Revoke(id)
+}
+
+// RevokeUser revokes all sessions of the user.
+func (s *StoredSessions) RevokeUser(user string) error {
+	return s.store.RevokeUser(user)
+}
+
+// List lists all the sessions of the user.
+func (s *StoredSessions) List(user string) ([]*SessionInfo, error) {
+	return s.store.List(user)
+}
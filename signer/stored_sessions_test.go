@@ -0,0 +1,101 @@
+// Copyright (C) 2021  Shanhu Tech Inc.
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License
+// for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"testing"
+
+	"time"
+
+	"shanhu.io/misc/errcode"
+)
+
+func testStoredSessions(t *testing.T, store SessionStore, now *time.Time) {
+	clock := func() time.Time { return *now }
+
+	sessions := NewSessions(nil, time.Hour)
+	sessions.TimeFunc = clock
+	s := NewStoredSessions(sessions, store)
+
+	s1, _, err := s.NewJSON("h8liu", "laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Add(time.Minute)
+	s2, _, err := s.NewJSON("h8liu", "phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.NewJSON("other", "desktop"); err != nil {
+		t.Fatal(err)
+	}
+
+	var device string
+	*now = now.Add(time.Minute)
+	if err := s.CheckJSON(s1, &device); err != nil {
+		t.Fatal(err)
+	}
+	if device != "laptop" {
+		t.Errorf("got device %q, want laptop", device)
+	}
+
+	list, err := s.List("h8liu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("got %d sessions, want 2", len(list))
+	}
+	if !list[0].LastSeen.Equal(*now) {
+		t.Errorf("got last seen %s, want %s", list[0].LastSeen, *now)
+	}
+
+	if err := s.Revoke(s1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Check(s1); !errcode.IsUnauthorized(err) {
+		t.Errorf("revoked session, got error %v", err)
+	}
+	if _, err := s.Check(s2); err != nil {
+		t.Errorf("check session 2: %s", err)
+	}
+
+	if err := s.RevokeUser("h8liu"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Check(s2); !errcode.IsUnauthorized(err) {
+		t.Errorf("revoked user session, got error %v", err)
+	}
+	if _, err := s.Check("bad-session"); !errcode.IsUnauthorized(err) {
+		t.Errorf("bad session, got error %v", err)
+	}
+
+	s3, _, err := s.NewJSON("other", "tablet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Add(2 * time.Hour)
+	if _, err := s.Check(s3); !errcode.IsUnauthorized(err) {
+		t.Errorf("expired session, got error %v", err)
+	}
+}
+
+func TestStoredSessions(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	store := NewMemSessionStore()
+	store.TimeFunc = func() time.Time { return now }
+	testStoredSessions(t, store, &now)
+}
@@ -16,10 +16,16 @@
 package signer
 
 import (
+	"encoding/binary"
 	"time"
+
+	"shanhu.io/misc/rand"
 )
 
-const timestampLen = 8
+const (
+	timestampLen = 8
+	nonceLen     = 16
+)
 
 func now(f func() time.Time) time.Time {
 	if f == nil {
@@ -33,3 +39,30 @@ func inWindow(t, tnow time.Time, w time.Duration) bool {
 	tend := tnow.Add(w)
 	return t.After(tstart) && t.Before(tend)
 }
+
+// timeData encodes a timestamp, optionally followed by a random nonce.
+func timeData(t time.Time, withNonce bool) []byte {
+	n := timestampLen
+	if withNonce {
+		n += nonceLen
+	}
+	buf := make([]byte, n)
+	binary.LittleEndian.PutUint64(buf, uint64(t.UnixNano()))
+	if withNonce {
+		copy(buf[timestampLen:], rand.Bytes(nonceLen))
+	}
+	return buf
+}
+
+// parseTimeData parses the timestamp and the optional nonce.
+func parseTimeData(bs []byte) (time.Time, []byte, bool) {
+	if len(bs) != timestampLen && len(bs) != timestampLen+nonceLen {
+		return time.Time{}, nil, false
+	}
+	t := time.Unix(0, int64(binary.LittleEndian.Uint64(bs)))
+	var nonce []byte
+	if len(bs) > timestampLen {
+		nonce = bs[timestampLen:]
+	}
+	return t, nonce, true
+}
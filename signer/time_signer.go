@@ -16,7 +16,6 @@
 package signer
 
 import (
-	"encoding/binary"
 	"time"
 )
 
@@ -29,17 +28,35 @@ type TimeSigner struct {
 	// TimeFunc is an optional function for reading teh current timestamp.
 	// When it is nil, the TimeSinger uses time.Now()
 	TimeFunc func() time.Time
+
+	// Encoding is the encoding of the tokens. Default is Hex.
+	Encoding Encoding
+
+	// ReplayCache is an optional cache for rejecting replayed tokens. When
+	// it is set, tokens must have a nonce, and each token can only pass
+	// the check once.
+	ReplayCache *ReplayCache
 }
 
-func signTime(s *Signer, t time.Time) string {
-	buf := make([]byte, timestampLen)
-	binary.LittleEndian.PutUint64(buf, uint64(t.UnixNano()))
-	return s.SignHex(buf)
+func signTime(s *Signer, t time.Time, enc Encoding, withNonce bool) string {
+	return enc.encode(s.Sign(timeData(t, withNonce)))
 }
 
 // SignTime signes the current time.
 func SignTime(key []byte) string {
-	return signTime(New(key), time.Now())
+	return signTime(New(key), time.Now(), Hex, false)
+}
+
+// SignTimeBase64 signes the current time, and returns the token in base64
+// URL encoding.
+func SignTimeBase64(key []byte) string {
+	return signTime(New(key), time.Now(), Base64URL, false)
+}
+
+// SignTimeNonce signes the current time with a random nonce, for checkers
+// that have replay protection.
+func SignTimeNonce(key []byte) string {
+	return signTime(New(key), time.Now(), Hex, true)
 }
 
 // NewTimeSigner creates a new time singer.
@@ -53,22 +70,44 @@ func NewTimeSigner(key []byte, window time.Duration) *TimeSigner {
 	}
 }
 
+// NewTimeSignerFromKeyRing creates a new time signer that signs with the
+// key ring.
+func NewTimeSignerFromKeyRing(r *KeyRing, window time.Duration) *TimeSigner {
+	if window < 0 {
+		window = -window
+	}
+	return &TimeSigner{
+		s:      NewFromKeyRing(r),
+		window: window,
+	}
+}
+
 // Token generates a signed token that has the current time reading.
 func (s *TimeSigner) Token() string {
-	return signTime(s.s, now(s.TimeFunc))
+	return signTime(s.s, now(s.TimeFunc), s.Encoding, false)
 }
 
-// Check checks if the timestamp is with in the time window.
+// NonceToken generates a signed token that has the current time reading
+// and a random nonce.
+func (s *TimeSigner) NonceToken() string {
+	return signTime(s.s, now(s.TimeFunc), s.Encoding, true)
+}
+
+// Check checks if the timestamp is with in the time window. When the signer
+// has a replay cache, it also checks that the token is not seen before.
 func (s *TimeSigner) Check(token string) bool {
-	ok, bs := s.s.CheckHex(token)
+	ok, bs := s.s.checkEncoded(token, s.Encoding)
 	if !ok {
 		return false
 	}
-	if len(bs) != timestampLen {
+	t, nonce, ok := parseTimeData(bs)
+	if !ok {
 		return false
 	}
 
-	t := time.Unix(0, int64(binary.LittleEndian.Uint64(bs)))
 	timeNow := now(s.TimeFunc)
-	return inWindow(t, timeNow, s.window)
+	if !inWindow(t, timeNow, s.window) {
+		return false
+	}
+	return checkReplay(s.ReplayCache, s.window, nonce, t, timeNow) == nil
 }